@@ -0,0 +1,375 @@
+package rest
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"sort"
+	"time"
+)
+
+const (
+	defaultAlignResolution = 100 * time.Millisecond
+	defaultAlignMaxOffset  = 5 * time.Minute
+	defaultAlignTolerance  = time.Second
+)
+
+// Ratios between the common frame rates. A subtitle synced for one release
+// usually drifts by one of them when it is played with another release.
+var defaultAlignRatios = []float64{
+	1,
+	25 / 23.976,
+	23.976 / 25,
+	25 / 24.0,
+	24 / 25.0,
+	24 / 23.976,
+	23.976 / 24,
+	30 / 29.97,
+	29.97 / 30,
+	25 / 29.97,
+	29.97 / 25,
+}
+
+type AlignParameters struct {
+	// The step at which the cue timings are sampled. Defaults to 100ms.
+	Resolution time.Duration
+
+	// The largest offset, in either direction, to look for. Defaults to 5m.
+	MaxOffset time.Duration
+
+	// The drift ratios to try before the fine fit. Defaults to the ratios
+	// between the common frame rates.
+	Ratios []float64
+
+	// The largest distance between a reference and a target cue start that
+	// still counts as a match during the fine fit. Defaults to 1s.
+	Tolerance time.Duration
+}
+
+// Describes how the target timings map onto the reference ones, so that
+// reference = target*Drift + Offset.
+type Alignment struct {
+	Offset time.Duration
+	Drift  float64
+
+	// The normalized correlation of the cue timing patterns after the
+	// alignment, from 0 to 1.
+	Score float64
+
+	// The number of target cues that start within the tolerance of a
+	// reference cue after the alignment.
+	Matched int
+}
+
+var errAlignEmpty = errors.New("rest: cannot align empty subtitles")
+
+// Estimates the offset and drift of the target subtitle against a well-synced
+// reference, possibly in another language, by cross-correlating the cue timing
+// patterns, and returns the retimed target.
+func Align(reference, target []*Cue, p *AlignParameters) ([]*Cue, *Alignment, error) {
+	if len(reference) == 0 || len(target) == 0 {
+		return nil, nil, errAlignEmpty
+	}
+
+	if p == nil {
+		p = &AlignParameters{}
+	}
+	res := p.Resolution
+	if res <= 0 {
+		res = defaultAlignResolution
+	}
+	maxOffset := p.MaxOffset
+	if maxOffset <= 0 {
+		maxOffset = defaultAlignMaxOffset
+	}
+	ratios := p.Ratios
+	if len(ratios) == 0 {
+		ratios = defaultAlignRatios
+	}
+	tol := p.Tolerance
+	if tol <= 0 {
+		tol = defaultAlignTolerance
+	}
+
+	ref := cueSignal(reference, 1, res)
+
+	var best *Alignment
+	for _, r := range ratios {
+		if r <= 0 {
+			continue
+		}
+		tgt := cueSignal(target, r, res)
+		lag, score := crossCorrelate(ref, tgt, int(maxOffset/res))
+		if best == nil || score > best.Score {
+			best = &Alignment{
+				Offset: time.Duration(lag) * res,
+				Drift: r,
+				Score: score,
+			}
+		}
+	}
+
+	a := refineAlignment(reference, target, best, tol)
+	a.Score = alignScore(ref, cueSignal(retime(target, a), 1, res))
+
+	return retime(target, a), a, nil
+}
+
+// Applies the alignment to the cues.
+func (a *Alignment) Apply(cues []*Cue) []*Cue {
+	return retime(cues, a)
+}
+
+func retime(cues []*Cue, a *Alignment) []*Cue {
+	out := make([]*Cue, 0, len(cues))
+	for _, c := range cues {
+		n := &Cue{
+			Start: a.transform(c.Start),
+			End: a.transform(c.End),
+			Text: c.Text,
+		}
+		if n.End < 0 {
+			continue
+		}
+		if n.Start < 0 {
+			n.Start = 0
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func (a *Alignment) transform(d time.Duration) time.Duration {
+	return time.Duration(math.Round(float64(d)*a.Drift)) + a.Offset
+}
+
+// Fits the drift and the offset by least squares over the pairs of cue starts
+// that match after the coarse alignment. The fit is repeated with the refined
+// alignment to pick up the pairs the coarse one missed.
+func refineAlignment(reference, target []*Cue, a *Alignment, tol time.Duration) *Alignment {
+	starts := make([]time.Duration, len(reference))
+	for i, c := range reference {
+		starts[i] = c.Start
+	}
+	sort.Slice(starts, func (i, j int) bool {
+		return starts[i] < starts[j]
+	})
+
+	cur := *a
+	for i := 0; i < 3; i += 1 {
+		var xs, ys []float64
+		for _, c := range target {
+			t := cur.transform(c.Start)
+			r, ok := nearestDuration(starts, t)
+			if !ok || absDuration(r-t) > tol {
+				continue
+			}
+			xs = append(xs, float64(c.Start))
+			ys = append(ys, float64(r))
+		}
+		cur.Matched = len(xs)
+
+		if len(xs) < 3 {
+			break
+		}
+		k, b, ok := linearFit(xs, ys)
+		if !ok || k <= 0 {
+			break
+		}
+		next := Alignment{
+			Offset: time.Duration(math.Round(b)),
+			Drift: k,
+		}
+		if next.Offset == cur.Offset && next.Drift == cur.Drift {
+			break
+		}
+		next.Matched = cur.Matched
+		cur = next
+	}
+
+	return &cur
+}
+
+func nearestDuration(s []time.Duration, d time.Duration) (time.Duration, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(s), func (i int) bool {
+		return s[i] >= d
+	})
+	switch {
+	case i == 0:
+		return s[0], true
+	case i == len(s):
+		return s[len(s)-1], true
+	case s[i]-d < d-s[i-1]:
+		return s[i], true
+	default:
+		return s[i-1], true
+	}
+}
+
+func linearFit(xs, ys []float64) (float64, float64, bool) {
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0, 0, false
+	}
+	k := (n*sxy - sx*sy) / d
+	b := (sy - k*sx) / n
+	return k, b, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Samples the cues into a signal that is 1 while a cue is shown and 0
+// otherwise.
+func cueSignal(cues []*Cue, drift float64, res time.Duration) []float64 {
+	var end time.Duration
+	for _, c := range cues {
+		e := time.Duration(float64(c.End) * drift)
+		if e > end {
+			end = e
+		}
+	}
+
+	s := make([]float64, int(end/res)+1)
+	for _, c := range cues {
+		i := int(time.Duration(float64(c.Start)*drift) / res)
+		j := int(time.Duration(float64(c.End)*drift) / res)
+		if i < 0 {
+			i = 0
+		}
+		for ; i <= j && i < len(s); i += 1 {
+			s[i] = 1
+		}
+	}
+	return s
+}
+
+// Finds the lag, within the given bound, at which the target signal overlaps
+// the reference one the most, and returns it with the normalized overlap.
+func crossCorrelate(ref, tgt []float64, maxLag int) (int, float64) {
+	n := 1
+	for n < len(ref)+len(tgt) {
+		n <<= 1
+	}
+
+	a := make([]complex128, n)
+	for i, v := range ref {
+		a[i] = complex(v, 0)
+	}
+	b := make([]complex128, n)
+	for i, v := range tgt {
+		b[i] = complex(v, 0)
+	}
+
+	fft(a, false)
+	fft(b, false)
+	for i := range a {
+		a[i] *= cmplx.Conj(b[i])
+	}
+	fft(a, true)
+
+	// The element at index k holds the overlap of the reference with the
+	// target shifted by k samples, negative shifts wrap around the end.
+	bestLag, bestVal := 0, math.Inf(-1)
+	for k := -maxLag; k <= maxLag; k += 1 {
+		i := k
+		if i < 0 {
+			i += n
+		}
+		if i < 0 || i >= n {
+			continue
+		}
+		v := real(a[i])
+		if v > bestVal || (v == bestVal && absInt(k) < absInt(bestLag)) {
+			bestLag, bestVal = k, v
+		}
+	}
+
+	return bestLag, bestVal / signalNorm(ref, tgt)
+}
+
+func alignScore(ref, tgt []float64) float64 {
+	var v float64
+	for i := 0; i < len(ref) && i < len(tgt); i += 1 {
+		v += ref[i] * tgt[i]
+	}
+	return v / signalNorm(ref, tgt)
+}
+
+func signalNorm(ref, tgt []float64) float64 {
+	var sr, st float64
+	for _, v := range ref {
+		sr += v
+	}
+	for _, v := range tgt {
+		st += v
+	}
+	n := math.Sqrt(sr * st)
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+func absInt(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// Computes an in-place radix-2 fast Fourier transform. The length of the input
+// must be a power of two.
+func fft(a []complex128, inverse bool) {
+	n := len(a)
+
+	for i, j := 1, 0; i < n; i += 1 {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+
+	for l := 2; l <= n; l <<= 1 {
+		ang := 2 * math.Pi / float64(l)
+		if !inverse {
+			ang = -ang
+		}
+		wl := cmplx.Rect(1, ang)
+		for i := 0; i < n; i += l {
+			w := complex(1, 0)
+			for j := 0; j < l/2; j += 1 {
+				u := a[i+j]
+				v := a[i+j+l/2] * w
+				a[i+j] = u + v
+				a[i+j+l/2] = u - v
+				w *= wl
+			}
+		}
+	}
+
+	if inverse {
+		for i := range a {
+			a[i] /= complex(float64(n), 0)
+		}
+	}
+}
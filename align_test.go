@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlign_FindsTheOffset(t *testing.T) {
+	ref := testCues(200)
+	tgt := (&Alignment{Offset: -7300 * time.Millisecond, Drift: 1}).Apply(ref)
+
+	a, al, err := Align(ref, tgt, nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 7300 * time.Millisecond, al.Offset, float64(50 * time.Millisecond))
+	assert.InDelta(t, 1, al.Drift, 1e-4)
+	assert.Greater(t, al.Score, 0.9)
+	equalCues(t, ref, a)
+}
+
+func TestAlign_FindsTheDrift(t *testing.T) {
+	ref := testCues(300)
+	tgt := (&Alignment{Offset: 2 * time.Second, Drift: 25 / 23.976}).Apply(ref)
+
+	a, al, err := Align(ref, tgt, nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 23.976 / 25, al.Drift, 1e-4)
+	assert.Equal(t, len(ref), al.Matched)
+	equalCues(t, ref, a)
+}
+
+func TestAlign_ReturnsAnErrorIfTheSubtitlesAreEmpty(t *testing.T) {
+	_, _, err := Align(nil, testCues(1), nil)
+	assert.Equal(t, errAlignEmpty, err)
+}
+
+func testCues(n int) []*Cue {
+	r := rand.New(rand.NewSource(1))
+	c := make([]*Cue, n)
+	s := 10 * time.Second
+	for i := range c {
+		s += time.Duration(500 + r.Intn(6000)) * time.Millisecond
+		d := time.Duration(800 + r.Intn(3500)) * time.Millisecond
+		c[i] = &Cue{Start: s, End: s + d, Text: "line"}
+		s += d
+	}
+	return c
+}
+
+func equalCues(t *testing.T, e, a []*Cue) {
+	require.Equal(t, len(e), len(a))
+	for i := range e {
+		d := math.Abs(float64(e[i].Start - a[i].Start))
+		assert.Less(t, d, float64(100 * time.Millisecond))
+	}
+}
@@ -0,0 +1,230 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	// Lets the requests through.
+	CircuitClosed CircuitState = iota
+
+	// Fails the requests fast with a CircuitOpenError.
+	CircuitOpen
+
+	// Lets one probe request through, and fails the others fast until the
+	// probe tells whether the server has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+)
+
+// Returned instead of sending a request while the circuit is open.
+type CircuitOpenError struct {
+	// The time the circuit lets a probe through.
+	RetryAt time.Time
+
+	// The failure that opened the circuit.
+	LastError error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("rest: circuit breaker is open until %s", e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastError
+}
+
+// Stops the client from sending requests to a server that is down. The circuit
+// opens after a number of consecutive server errors or transport errors, fails
+// the requests fast while it is open, and lets a probe through once the
+// cooldown has passed. A successful probe closes the circuit, a failed one
+// opens it again.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	lastErr  error
+	openedAt time.Time
+	probing  bool
+
+	// The number of consecutive failures that opens the circuit. Defaults to 5.
+	Threshold int
+
+	// The time the circuit stays open before it lets a probe through. Defaults
+	// to 30s.
+	Cooldown time.Duration
+}
+
+// Describes the circuit for health checks.
+type CircuitStatus struct {
+	State CircuitState
+
+	// The number of consecutive failures.
+	Failures int
+
+	// The time the circuit opened and the time it lets a probe through, if it is
+	// not closed.
+	OpenedAt time.Time
+	RetryAt  time.Time
+
+	LastError error
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown: cooldown,
+	}
+}
+
+// Returns the state of the circuit.
+func (b *CircuitBreaker) State() CircuitState {
+	return b.Status().State
+}
+
+// Returns the status of the circuit. An open circuit whose cooldown has passed
+// is reported as half-open.
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := CircuitStatus{
+		State: b.state,
+		Failures: b.failures,
+		LastError: b.lastErr,
+	}
+	if b.state != CircuitClosed {
+		s.OpenedAt = b.openedAt
+		s.RetryAt = b.openedAt.Add(b.cooldown())
+		if b.state == CircuitOpen && !time.Now().Before(s.RetryAt) {
+			s.State = CircuitHalfOpen
+		}
+	}
+	return s
+}
+
+// Closes the circuit and forgets the failures.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = CircuitClosed
+	b.failures = 0
+	b.lastErr = nil
+	b.probing = false
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold <= 0 {
+		return defaultCircuitThreshold
+	}
+	return b.Threshold
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return defaultCircuitCooldown
+	}
+	return b.Cooldown
+}
+
+// Returns an error if the circuit does not let the request through, and
+// reports whether the request is the probe.
+func (b *CircuitBreaker) allow(now time.Time) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && !now.Before(b.openedAt.Add(b.cooldown())) {
+		b.state = CircuitHalfOpen
+	}
+
+	switch {
+	case b.state == CircuitClosed:
+		return false, nil
+	case b.state == CircuitHalfOpen && !b.probing:
+		b.probing = true
+		return true, nil
+	default:
+		return false, &CircuitOpenError{
+			RetryAt: b.openedAt.Add(b.cooldown()),
+			LastError: b.lastErr,
+		}
+	}
+}
+
+// Updates the circuit with the outcome of a request.
+func (b *CircuitBreaker) report(probe bool, res *Response, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrNoAPIKeys) {
+		// The caller gave up, or the request was not sent, which tells nothing
+		// about the server.
+		return
+	}
+
+	if !isServerFailure(res, err) {
+		if probe || b.state == CircuitClosed {
+			b.state = CircuitClosed
+			b.failures = 0
+			b.lastErr = nil
+		}
+		return
+	}
+
+	b.failures += 1
+	b.lastErr = err
+	if probe || (b.state == CircuitClosed && b.failures >= b.threshold()) {
+		b.state = CircuitOpen
+		b.openedAt = now
+	}
+}
+
+// Reports whether the outcome of a request tells that the server is down: a
+// server error, or a transport error with no response at all.
+func isServerFailure(res *Response, err error) bool {
+	if res != nil && res.Response != nil {
+		return res.StatusCode >= 500
+	}
+	return err != nil
+}
+
+// Sends the request through the handler unless the circuit is open.
+func (c *Client) doWithBreaker(ctx context.Context, req *http.Request, h RequestHandler) (*Response, error) {
+	b := c.CircuitBreaker
+	probe, err := b.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	res, err := h(ctx, req)
+	b.report(probe, res, err, time.Now())
+	return res, err
+}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_OpensAfterConsecutiveServerErrors(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	down := true
+	n := 0
+	mux.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		if down {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `<html><title>502 Bad Gateway</title></html>`)
+			return
+		}
+		fmt.Fprint(w, `{"data": {}}`)
+	})
+
+	b := NewCircuitBreaker(3, 50*time.Millisecond)
+	client.CircuitBreaker = b
+	client = client.WithAuthToken("xxx")
+
+	ctx := context.Background()
+	for i := 0; i < 3; i += 1 {
+		assert.Equal(t, CircuitClosed, b.State())
+		_, _, err := client.Users.Get(ctx)
+		require.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.Equal(t, 3, b.Status().Failures)
+
+	_, _, err := client.Users.Get(ctx)
+	var ce *CircuitOpenError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, b.Status().RetryAt, ce.RetryAt)
+	assert.Equal(t, "CircuitOpenError", ErrorClass(err))
+	assert.Equal(t, 3, n)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, b.State())
+
+	_, _, err = client.Users.Get(ctx)
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &ce))
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.Equal(t, 4, n)
+
+	time.Sleep(60 * time.Millisecond)
+	down = false
+	_, _, err = client.Users.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, b.State())
+	assert.Equal(t, 0, b.Status().Failures)
+	assert.Equal(t, 5, n)
+}
+
+func TestCircuitBreaker_ResetsTheFailuresOnSuccess(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Minute)
+	now := time.Now()
+	failure := &Response{Response: &http.Response{StatusCode: 500}}
+	success := &Response{Response: &http.Response{StatusCode: 404}}
+
+	b.report(false, failure, errors.New("down"), now)
+	b.report(false, success, errors.New("not found"), now)
+	b.report(false, failure, errors.New("down"), now)
+	assert.Equal(t, CircuitClosed, b.State())
+
+	b.report(false, nil, errors.New("connection refused"), now)
+	assert.Equal(t, CircuitOpen, b.State())
+}
+
+func TestCircuitBreaker_IgnoresTheCallerErrors(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	now := time.Now()
+
+	b.report(false, nil, context.Canceled, now)
+	b.report(false, nil, fmt.Errorf("wrapped: %w", context.DeadlineExceeded), now)
+	b.report(false, nil, ErrNoAPIKeys, now)
+	assert.Equal(t, CircuitClosed, b.State())
+}
+
+func TestCircuitBreaker_LetsOneProbeThrough(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	now := time.Now()
+
+	b.report(false, nil, errors.New("down"), now)
+	_, err := b.allow(now)
+	assert.Error(t, err)
+
+	later := now.Add(time.Minute)
+	probe, err := b.allow(later)
+	require.NoError(t, err)
+	assert.True(t, probe)
+
+	_, err = b.allow(later)
+	assert.Error(t, err)
+
+	b.report(true, &Response{Response: &http.Response{StatusCode: 200}}, nil, later)
+	probe, err = b.allow(later)
+	require.NoError(t, err)
+	assert.False(t, probe)
+}
+
+func TestCircuitBreaker_IsCopiedWithTheClient(t *testing.T) {
+	client := NewClient(nil)
+	client.CircuitBreaker = NewCircuitBreaker(0, 0)
+	assert.Equal(t, client.CircuitBreaker, client.WithAuthToken("xxx").CircuitBreaker)
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+}
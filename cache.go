@@ -0,0 +1,422 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const cacheIndexName = "index.json"
+
+// A local cache of downloaded subtitles, keyed by the file ID and the download
+// parameters that change the content. The content is stored once per checksum,
+// verified on every read, and the least recently used entries are evicted when
+// the cache grows over its size. The directory can be shared between the
+// processes of one host: the index is read again and changed under an advisory
+// lock, and a read only touches the modification time of the content, which
+// tells the least recently used entries apart.
+type DownloadCache struct {
+	mu  sync.Mutex
+	dir string
+
+	// The largest total size of the content in bytes. Zero means unbounded.
+	MaxSize int64
+}
+
+type cacheEntry struct {
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	FileName string `json:"file_name,omitempty"`
+}
+
+// Opens the cache stored in the directory, creating the directory if needed.
+func OpenDownloadCache(dir string, maxSize int64) (*DownloadCache, error) {
+	err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &DownloadCache{
+		dir: dir,
+		MaxSize: maxSize,
+	}
+
+	_, err = c.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Returns the key of the download parameters. The file name and the force flag
+// do not change the content, so they are not a part of the key.
+func cacheKey(p *SubtitlesDownloadParameters) string {
+	return fmt.Sprintf("%d:%s:%d:%d:%d", p.FileID, p.SubFormat, p.InFPS, p.OutFPS, p.Timeshift)
+}
+
+// Returns the cached content for the download parameters and reports whether
+// there was a hit. Content that fails the checksum is dropped and reported as a
+// miss.
+func (c *DownloadCache) Get(p *SubtitlesDownloadParameters) ([]byte, *CachedFile, bool, error) {
+	var data []byte
+	var f *CachedFile
+	err := c.update(func (index map[string]*cacheEntry) (bool, error) {
+		k := cacheKey(p)
+		e, ok := index[k]
+		if !ok {
+			return false, nil
+		}
+
+		n := c.blobPath(e.SHA256)
+		b, err := os.ReadFile(n)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		if err != nil || checksum(b) != e.SHA256 {
+			delete(index, k)
+			c.removeUnreferenced(index, e.SHA256)
+			return true, nil
+		}
+
+		now := time.Now()
+		os.Chtimes(n, now, now)
+
+		data = b
+		f = &CachedFile{FileName: e.FileName, SHA256: e.SHA256, Size: e.Size}
+		return false, nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return data, f, f != nil, nil
+}
+
+// Reports whether the cache has an entry for the download parameters, without
+// verifying its content.
+func (c *DownloadCache) Contains(p *SubtitlesDownloadParameters) bool {
+	index, err := c.loadIndex()
+	if err != nil {
+		return false
+	}
+	_, ok := index[cacheKey(p)]
+	return ok
+}
+
+// Stores the content for the download parameters and evicts the least recently
+// used entries if the cache has grown over its size.
+func (c *DownloadCache) Put(p *SubtitlesDownloadParameters, fileName string, data []byte) error {
+	return c.update(func (index map[string]*cacheEntry) (bool, error) {
+		sum := checksum(data)
+		n := c.blobPath(sum)
+		_, err := os.Stat(n)
+		if errors.Is(err, os.ErrNotExist) {
+			err = writeFileAtomic(n, data, 0644)
+		} else if err == nil {
+			now := time.Now()
+			err = os.Chtimes(n, now, now)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		k := cacheKey(p)
+		old, ok := index[k]
+		index[k] = &cacheEntry{
+			SHA256: sum,
+			Size: int64(len(data)),
+			FileName: fileName,
+		}
+		if ok && old.SHA256 != sum {
+			c.removeUnreferenced(index, old.SHA256)
+		}
+
+		c.evict(index)
+		return true, nil
+	})
+}
+
+// Removes the entry for the download parameters, such as one whose content
+// turned out to be wrong.
+func (c *DownloadCache) Remove(p *SubtitlesDownloadParameters) error {
+	return c.update(func (index map[string]*cacheEntry) (bool, error) {
+		k := cacheKey(p)
+		e, ok := index[k]
+		if !ok {
+			return false, nil
+		}
+		delete(index, k)
+		c.removeUnreferenced(index, e.SHA256)
+		return true, nil
+	})
+}
+
+// Returns the total size of the cached content.
+func (c *DownloadCache) Size() int64 {
+	index, err := c.loadIndex()
+	if err != nil {
+		return 0
+	}
+	return cacheSize(index)
+}
+
+func cacheSize(index map[string]*cacheEntry) int64 {
+	var s int64
+	seen := map[string]bool{}
+	for _, e := range index {
+		if seen[e.SHA256] {
+			continue
+		}
+		seen[e.SHA256] = true
+		s += e.Size
+	}
+	return s
+}
+
+// Evicts the entries whose content was used the longest time ago until the
+// cache fits its size.
+func (c *DownloadCache) evict(index map[string]*cacheEntry) {
+	if c.MaxSize <= 0 || cacheSize(index) <= c.MaxSize {
+		return
+	}
+
+	used := map[string]time.Time{}
+	keys := make([]string, 0, len(index))
+	for k, e := range index {
+		keys = append(keys, k)
+		if _, ok := used[e.SHA256]; ok {
+			continue
+		}
+		st, err := os.Stat(c.blobPath(e.SHA256))
+		if err == nil {
+			used[e.SHA256] = st.ModTime()
+		} else {
+			used[e.SHA256] = time.Time{}
+		}
+	}
+	sort.Slice(keys, func (i, j int) bool {
+		a, b := used[index[keys[i]].SHA256], used[index[keys[j]].SHA256]
+		if a.Equal(b) {
+			return keys[i] < keys[j]
+		}
+		return a.Before(b)
+	})
+
+	for _, k := range keys {
+		if cacheSize(index) <= c.MaxSize {
+			return
+		}
+		e := index[k]
+		delete(index, k)
+		c.removeUnreferenced(index, e.SHA256)
+	}
+}
+
+func (c *DownloadCache) removeUnreferenced(index map[string]*cacheEntry, sum string) {
+	for _, e := range index {
+		if e.SHA256 == sum {
+			return
+		}
+	}
+	os.Remove(c.blobPath(sum))
+}
+
+func (c *DownloadCache) blobPath(sum string) string {
+	return filepath.Join(c.dir, "blobs", sum)
+}
+
+// Runs fn with the index read again under the lock that the processes sharing
+// the directory take, and saves the index if fn reports that it changed it.
+func (c *DownloadCache) update(fn func (index map[string]*cacheEntry) (bool, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(c.dir, cacheIndexName+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = lockFile(f)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	index, err := c.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(index)
+	if err != nil || !changed {
+		return err
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, cacheIndexName), data, 0644)
+}
+
+// Reads the index. It is replaced atomically, so it can be read without the
+// lock.
+func (c *DownloadCache) loadIndex() (map[string]*cacheEntry, error) {
+	index := map[string]*cacheEntry{}
+	data, err := os.ReadFile(filepath.Join(c.dir, cacheIndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot read the download cache index: %w", err)
+	}
+	return index, nil
+}
+
+func checksum(data []byte) string {
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+// Describes the content written by DownloadFile.
+type CachedFile struct {
+	FileName string
+	SHA256   string
+	Size     int64
+
+	// Reports whether the content was served from the cache, in which case no
+	// download was requested and the quota was not spent.
+	Cached bool
+}
+
+// Downloads the content of a subtitle and writes it to w. If the client has a
+// download cache, a hit is served from it without a request, so the returned
+// response is nil, and a miss is stored in it.
+func (s *SubtitlesService) DownloadFile(ctx context.Context, p *SubtitlesDownloadParameters, w io.Writer) (*CachedFile, *Response, error) {
+	c := s.client.DownloadCache
+
+	if c != nil {
+		data, f, ok, err := c.Get(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			_, err = w.Write(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			f.Cached = true
+			s.client.count(ctx, MetricCacheHits)
+			if l := s.client.DownloadLedger; l != nil {
+				err = l.Record(&LedgerEntry{
+					FileID: p.FileID,
+					SubtitleID: subtitleIDFrom(ctx),
+					Cached: true,
+				})
+				if err != nil {
+					return f, nil, &QuotaCommitError{Err: err}
+				}
+			}
+			return f, nil, nil
+		}
+	}
+
+	var commitErr *QuotaCommitError
+	d, res, err := s.Download(ctx, p)
+	if err != nil && !errors.As(err, &commitErr) {
+		return nil, res, err
+	}
+	if d.Link == nil {
+		return nil, res, fmt.Errorf("rest: download response has no link")
+	}
+
+	var b bytes.Buffer
+	_, err = s.fetch(ctx, *d.Link, &b)
+	if err != nil {
+		return nil, res, err
+	}
+	data := b.Bytes()
+
+	f := &CachedFile{
+		SHA256: checksum(data),
+		Size: int64(len(data)),
+	}
+	if d.FileName != nil {
+		f.FileName = *d.FileName
+	}
+
+	if c != nil {
+		err = c.Put(p, f.FileName, data)
+		if err != nil {
+			return nil, res, err
+		}
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, res, err
+	}
+
+	if commitErr != nil {
+		return f, res, commitErr
+	}
+	return f, res, nil
+}
+
+// Fetches the file behind a download link. The link points outside of the API,
+// so it is fetched with a plain GET that has none of the credentials and skips
+// the breaker, the coalescer and the middleware of Use. It goes through the
+// middleware of UseForLinks.
+func (s *SubtitlesService) fetch(ctx context.Context, link string, w io.Writer) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.client.UserAgent != "" {
+		req.Header.Set("User-Agent", s.client.UserAgent)
+	}
+
+	res, err := s.client.instrumented(ctx, req, s.client.linkHandler())
+	if err != nil {
+		return res, err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(w, res.Body)
+	return res, err
+}
+
+func (c *Client) plainDo(ctx context.Context, req *http.Request) (*Response, error) {
+	r, err := c.plain.Do(req)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			return nil, err
+		}
+	}
+
+	res := newResponse(r, nil)
+	err = checkResponse(r, false)
+	if err != nil {
+		r.Body.Close()
+	}
+	return res, err
+}
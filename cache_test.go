@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadCache_StoresAndVerifiesContent(t *testing.T) {
+	d := t.TempDir()
+	c, err := OpenDownloadCache(d, 0)
+	require.NoError(t, err)
+
+	p := &SubtitlesDownloadParameters{FileID: 1, SubFormat: "srt"}
+	_, _, ok, err := c.Get(p)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	err = c.Put(p, "a.srt", []byte("content"))
+	require.NoError(t, err)
+	assert.True(t, c.Contains(p))
+	assert.False(t, c.Contains(&SubtitlesDownloadParameters{FileID: 1, SubFormat: "vtt"}))
+	assert.True(t, c.Contains(&SubtitlesDownloadParameters{FileID: 1, SubFormat: "srt", FileName: "b"}))
+
+	c, err = OpenDownloadCache(d, 0)
+	require.NoError(t, err)
+	a, f, ok, err := c.Get(p)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "content", string(a))
+	assert.Equal(t, "a.srt", f.FileName)
+	assert.Equal(t, checksum([]byte("content")), f.SHA256)
+
+	err = os.WriteFile(c.blobPath(f.SHA256), []byte("tampered"), 0644)
+	require.NoError(t, err)
+	_, _, ok, err = c.Get(p)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, c.Contains(p))
+}
+
+func TestDownloadCache_EvictsTheLeastRecentlyUsed(t *testing.T) {
+	c, err := OpenDownloadCache(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	p := func (id int64) *SubtitlesDownloadParameters {
+		return &SubtitlesDownloadParameters{FileID: ID(id)}
+	}
+
+	err = c.Put(p(1), "", []byte("aaaa"))
+	require.NoError(t, err)
+	err = c.Put(p(2), "", []byte("bbbb"))
+	require.NoError(t, err)
+	_, _, _, err = c.Get(p(1))
+	require.NoError(t, err)
+	err = c.Put(p(3), "", []byte("cccc"))
+	require.NoError(t, err)
+
+	assert.True(t, c.Contains(p(1)))
+	assert.False(t, c.Contains(p(2)))
+	assert.True(t, c.Contains(p(3)))
+	assert.Equal(t, int64(8), c.Size())
+
+	m, err := filepath.Glob(filepath.Join(c.dir, "blobs", "*"))
+	require.NoError(t, err)
+	assert.Len(t, m, 2)
+}
+
+func TestDownloadCache_SharesTheDirectoryBetweenInstances(t *testing.T) {
+	d := t.TempDir()
+	a, err := OpenDownloadCache(d, 0)
+	require.NoError(t, err)
+	b, err := OpenDownloadCache(d, 0)
+	require.NoError(t, err)
+
+	p := func (id int64) *SubtitlesDownloadParameters {
+		return &SubtitlesDownloadParameters{FileID: ID(id)}
+	}
+
+	err = a.Put(p(1), "", []byte("aaaa"))
+	require.NoError(t, err)
+	err = b.Put(p(2), "", []byte("bbbb"))
+	require.NoError(t, err)
+	assert.True(t, a.Contains(p(2)))
+	assert.True(t, b.Contains(p(1)))
+
+	err = b.Put(p(1), "", []byte("cccc"))
+	require.NoError(t, err)
+	data, _, ok, err := a.Get(p(1))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "cccc", string(data))
+
+	m, err := filepath.Glob(filepath.Join(d, "blobs", "*"))
+	require.NoError(t, err)
+	assert.Len(t, m, 2)
+}
+
+func TestDownloadCache_DoesNotRewriteTheIndexOnARead(t *testing.T) {
+	c, err := OpenDownloadCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	p := &SubtitlesDownloadParameters{FileID: 1}
+	err = c.Put(p, "", []byte("content"))
+	require.NoError(t, err)
+
+	name := filepath.Join(c.dir, cacheIndexName)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(name, old, old)
+	require.NoError(t, err)
+
+	_, _, ok, err := c.Get(p)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	st, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.True(t, old.Equal(st.ModTime()))
+}
+
+func TestSubtitlesServiceDownloadFile_ServesHitsFromTheCache(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	n := 0
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%sfile"}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "subtitle")
+	})
+
+	c, err := OpenDownloadCache(t.TempDir(), 0)
+	require.NoError(t, err)
+	client.DownloadCache = c
+
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+
+	var b bytes.Buffer
+	f, res, err := client.Subtitles.DownloadFile(ctx, p, &b)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.False(t, f.Cached)
+	assert.Equal(t, "a.srt", f.FileName)
+	assert.Equal(t, "subtitle", b.String())
+
+	b.Reset()
+	f, res, err = client.Subtitles.DownloadFile(ctx, p, &b)
+	require.NoError(t, err)
+	assert.Nil(t, res)
+	assert.True(t, f.Cached)
+	assert.Equal(t, "subtitle", b.String())
+	assert.Equal(t, 1, n)
+
+	l := NewDownloadLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	l.Reserve = 100
+	b.Reset()
+	f, _, err = l.DownloadFile(ctx, client.Subtitles, p, 0, &b)
+	require.NoError(t, err)
+	assert.True(t, f.Cached)
+	e, err := l.Entries()
+	require.NoError(t, err)
+	require.Len(t, e, 1)
+	assert.True(t, e[0].Cached)
+}
+
+func TestSubtitlesServiceDownloadFile_FetchesTheLinkWithoutCredentials(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%sfile"}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Api-Key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		fmt.Fprint(w, "subtitle")
+	})
+
+	c := client.WithAuthToken("token")
+	var paths []string
+	c.Use(func (next RequestHandler) RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*Response, error) {
+			paths = append(paths, req.URL.Path)
+			return next(ctx, req)
+		}
+	})
+
+	var b bytes.Buffer
+	_, _, err := c.Subtitles.DownloadFile(context.Background(), &SubtitlesDownloadParameters{FileID: 1}, &b)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", b.String())
+	assert.Equal(t, []string{"/download"}, paths)
+}
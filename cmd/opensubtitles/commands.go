@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opensubtitlescli/rest"
+)
+
+func login(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	username := fs.String("username", e.config.Username, "the username to log in with")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the standard input")
+	err := e.parse(fs, "[-username name] [-password-stdin]", args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("login: unexpected argument %q", fs.Arg(0))
+	}
+
+	password := e.config.Password
+	if *passwordStdin {
+		s := bufio.NewScanner(e.stdin)
+		if s.Scan() {
+			password = strings.TrimRight(s.Text(), "\r")
+		}
+		err = s.Err()
+		if err != nil {
+			return err
+		}
+	}
+	if *username == "" || password == "" {
+		return usagef("login: no credentials, set %s and %s, or pass -username and -password-stdin", envUsername, envPassword)
+	}
+
+	m, err := e.sessions()
+	if err != nil {
+		return err
+	}
+	m.Credentials = &rest.Credentials{Username: *username, Password: password}
+
+	// Logging in replaces the stored session, even if it is still valid.
+	err = m.Store.Clear()
+	if err != nil {
+		return err
+	}
+	_, s, err := m.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return printJSON(e.stdout, s)
+	}
+	fmt.Fprintf(e.stdout, "logged in as %s, %s\n", *username, validity(s))
+	return nil
+}
+
+func logout(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	err := e.parse(fs, "", args)
+	if err != nil {
+		return err
+	}
+
+	m, err := e.sessions()
+	if err != nil {
+		return err
+	}
+	err = m.Logout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !e.json {
+		fmt.Fprintln(e.stdout, "logged out")
+	}
+	return nil
+}
+
+func user(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("user", flag.ContinueOnError)
+	err := e.parse(fs, "", args)
+	if err != nil {
+		return err
+	}
+
+	c, s, err := e.authenticated(ctx, true)
+	if err != nil {
+		return err
+	}
+	u, _, err := c.Users.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return printJSON(e.stdout, u)
+	}
+	t := newTable(e.stdout, "FIELD", "VALUE")
+	t.row("username", str(u.Username))
+	t.row("user id", id(u.UserID))
+	t.row("level", str(u.Level))
+	t.row("vip", yesNo(u.VIP))
+	t.row("downloads", fmt.Sprintf("%s of %s", num(u.DownloadsCount), num(u.AllowedDownloads)))
+	t.row("remaining", num(u.RemainingDownloads))
+	t.row("session", validity(s))
+	return t.flush()
+}
+
+func search(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return usagef("search: expected subtitles or features")
+	}
+	switch args[0] {
+	case "subtitles":
+		return searchSubtitles(ctx, e, args[1:])
+	case "features":
+		return searchFeatures(ctx, e, args[1:])
+	case "-h", "-help", "--help":
+		fmt.Fprintln(e.stdout, "Usage: opensubtitles search subtitles|features [flags] [query]")
+		return errHelp
+	default:
+		return usagef("search: expected subtitles or features, got %q", args[0])
+	}
+}
+
+func searchSubtitles(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("search subtitles", flag.ContinueOnError)
+	p := &rest.SubtitlesSearchParameters{}
+	languages := fs.String("languages", "", "the comma-separated language codes, such as en,de")
+	file := fs.String("file", "", "the video file to search by the moviehash of")
+	fs.StringVar(&p.Moviehash, "moviehash", "", "the moviehash to search by")
+	fs.Var((*idValue)(&p.IMDBID), "imdb", "the IMDb ID to search by")
+	fs.Var((*idValue)(&p.TMDBID), "tmdb", "the TMDB ID to search by")
+	fs.Var((*idValue)(&p.ID), "feature", "the feature ID to search by")
+	fs.IntVar(&p.Year, "year", 0, "the year of the feature")
+	fs.IntVar(&p.SeasonNumber, "season", 0, "the season of the episode")
+	fs.IntVar(&p.EpisodeNumber, "episode", 0, "the number of the episode")
+	fs.StringVar(&p.Type, "type", "", "the type of the feature: movie, episode or all")
+	fs.StringVar(&p.HearingImpaired, "hearing-impaired", "", "include, exclude or only")
+	fs.StringVar(&p.ForeignPartsOnly, "foreign-parts-only", "", "include, exclude or only")
+	fs.StringVar(&p.OrderBy, "order-by", "", "the field to order by, such as ratings")
+	fs.IntVar(&p.Page, "page", 0, "the page of the results")
+	err := e.parse(fs, "[flags] [query]", args)
+	if err != nil {
+		return err
+	}
+
+	p.Query = strings.Join(fs.Args(), " ")
+	if *languages != "" {
+		p.Languages = strings.Split(*languages, ",")
+	}
+	if *file != "" {
+		p.Moviehash, err = rest.MoviehashFile(*file)
+		if err != nil {
+			return err
+		}
+	}
+
+	c, _, err := e.authenticated(ctx, false)
+	if err != nil {
+		return err
+	}
+	d, res, err := c.Subtitles.Search(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	err = e.printSubtitles(d)
+	if err != nil {
+		return err
+	}
+	e.printPagination(res, "subtitles")
+	return nil
+}
+
+func searchFeatures(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("search features", flag.ContinueOnError)
+	p := &rest.FeaturesSearchParameters{}
+	fs.Var((*idValue)(&p.FeatureID), "feature", "the feature ID to search by")
+	fs.Var((*idValue)(&p.IMDBID), "imdb", "the IMDb ID to search by")
+	fs.Var((*idValue)(&p.TMDBID), "tmdb", "the TMDB ID to search by")
+	fs.StringVar(&p.Type, "type", "", "the type of the feature: movie, tvshow or episode")
+	fs.IntVar(&p.Year, "year", 0, "the year of the feature")
+	err := e.parse(fs, "[flags] [query]", args)
+	if err != nil {
+		return err
+	}
+	p.Query = strings.Join(fs.Args(), " ")
+
+	c, _, err := e.authenticated(ctx, false)
+	if err != nil {
+		return err
+	}
+	d, _, err := c.Features.Search(ctx, p)
+	if err != nil {
+		return err
+	}
+	return e.printFeatures(d)
+}
+
+func popular(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("popular", flag.ContinueOnError)
+	features := fs.Bool("features", false, "list the features instead of the subtitles")
+	languages := fs.String("languages", "", "the comma-separated language codes, such as en,de")
+	typ := fs.String("type", "", "the type of the feature: movie, tvshow or episode")
+	err := e.parse(fs, "[-features] [-languages list] [-type type]", args)
+	if err != nil {
+		return err
+	}
+	var l []string
+	if *languages != "" {
+		l = strings.Split(*languages, ",")
+	}
+
+	c, _, err := e.authenticated(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	if *features {
+		d, _, err := c.Features.Popular(ctx, &rest.FeaturesPopularParameters{Languages: l, Type: *typ})
+		if err != nil {
+			return err
+		}
+		return e.printFeatures(d)
+	}
+
+	d, _, err := c.Subtitles.Popular(ctx, &rest.SubtitlesPopularParameters{Languages: l, Type: *typ})
+	if err != nil {
+		return err
+	}
+	return e.printSubtitles(d)
+}
+
+func latest(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("latest", flag.ContinueOnError)
+	languages := fs.String("languages", "", "the comma-separated language codes, such as en,de")
+	typ := fs.String("type", "", "the type of the feature: movie, tvshow or episode")
+	err := e.parse(fs, "[-languages list] [-type type]", args)
+	if err != nil {
+		return err
+	}
+	p := &rest.SubtitlesLatestParameters{Type: *typ}
+	if *languages != "" {
+		p.Languages = strings.Split(*languages, ",")
+	}
+
+	c, _, err := e.authenticated(ctx, false)
+	if err != nil {
+		return err
+	}
+	d, _, err := c.Subtitles.Latest(ctx, p)
+	if err != nil {
+		return err
+	}
+	return e.printSubtitles(d)
+}
+
+func languages(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("languages", flag.ContinueOnError)
+	err := e.parse(fs, "", args)
+	if err != nil {
+		return err
+	}
+
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	d, _, err := c.Languages.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return printJSON(e.stdout, d)
+	}
+	t := newTable(e.stdout, "CODE", "NAME")
+	for _, l := range d {
+		if l == nil {
+			continue
+		}
+		t.row(str(l.LanguageCode), str(l.LanguageName))
+	}
+	return t.flush()
+}
+
+func formats(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("formats", flag.ContinueOnError)
+	err := e.parse(fs, "", args)
+	if err != nil {
+		return err
+	}
+
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+	d, _, err := c.Formats.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return printJSON(e.stdout, d)
+	}
+	t := newTable(e.stdout, "FORMAT")
+	for _, f := range d.OutputFormats {
+		t.row(str(f))
+	}
+	return t.flush()
+}
+
+func download(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	out := fs.String("o", "", "the path to save to, - for the standard output, or the file ID with the extension of the format in the current directory")
+	format := fs.String("format", "", "the format to convert to, such as srt")
+	force := fs.Bool("force", false, "replace an existing file")
+	err := e.parse(fs, "[-o path] [-format format] [-force] file-id", args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usagef("download: expected one file id")
+	}
+	n, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return usagef("download: invalid file id %q", fs.Arg(0))
+	}
+	p := &rest.SubtitlesDownloadParameters{FileID: rest.ID(n), SubFormat: *format}
+
+	c, _, err := e.authenticated(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		_, res, err := c.Subtitles.DownloadFile(ctx, p, e.stdout)
+		if err != nil {
+			return err
+		}
+		e.printRemaining(res)
+		return nil
+	}
+
+	// The file name of the subtitle is only known once the download has been
+	// requested, which spends the quota, so the default name is made of the
+	// file ID. DownloadToPath refuses an existing file before the request. The
+	// command does not check the file later, so it leaves out the checksum file.
+	path := *out
+	if path == "" {
+		ext := *format
+		if ext == "" {
+			ext = "srt"
+		}
+		path = fmt.Sprintf("%d.%s", n, ext)
+	}
+	d, res, err := c.Subtitles.DownloadToPath(ctx, p, path, &rest.DownloadToPathParameters{
+		Overwrite: *force,
+		SkipChecksum: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return printJSON(e.stdout, d)
+	}
+	fmt.Fprintf(e.stdout, "saved %s (%d bytes)\n", d.Path, d.Size)
+	e.printRemaining(res)
+	return nil
+}
+
+func (e *env) printSubtitles(d []*rest.SubtitleEntity) error {
+	if e.json {
+		return printJSON(e.stdout, d)
+	}
+	t := newTable(e.stdout, "FILE ID", "LANG", "RELEASE", "RATING", "DOWNLOADS", "FLAGS")
+	for _, s := range d {
+		if s == nil || s.Attributes == nil {
+			continue
+		}
+		a := s.Attributes
+		f := "-"
+		if len(a.Files) > 0 && a.Files[0] != nil {
+			f = id(a.Files[0].FileID)
+		}
+		t.row(f, str(a.Language), str(a.Release), rating(a.Ratings), num(a.DownloadCount), subtitleFlags(a))
+	}
+	return t.flush()
+}
+
+func (e *env) printFeatures(d []*rest.FeatureEntity) error {
+	if e.json {
+		return printJSON(e.stdout, d)
+	}
+	t := newTable(e.stdout, "ID", "TYPE", "TITLE", "YEAR", "SUBTITLES")
+	for _, f := range d {
+		if f == nil || f.Attributes == nil {
+			continue
+		}
+		a := f.Attributes
+		t.row(id(a.FeatureID), str(a.FeatureType), str(a.Title), str(a.Year), num(a.SubtitlesCount))
+	}
+	return t.flush()
+}
+
+func (e *env) printPagination(res *rest.Response, what string) {
+	if e.json || res == nil || res.Pagination.TotalPages == 0 {
+		return
+	}
+	p := res.Pagination
+	fmt.Fprintf(e.stderr, "page %d of %d, %d %s\n", p.Page, p.TotalPages, p.TotalCount, what)
+}
+
+func (e *env) printRemaining(res *rest.Response) {
+	if res == nil || res.Quota.ResetTimeUTC.IsZero() {
+		return
+	}
+	fmt.Fprintf(e.stderr, "%d downloads remaining\n", res.Quota.Remaining)
+}
+
+// Returns the tags of the subtitle, such as "hi,trusted".
+func subtitleFlags(a *rest.Subtitle) string {
+	var r []string
+	for _, f := range []struct {
+		name string
+		v    *bool
+	}{
+		{"hi", a.HearingImpaired},
+		{"forced", a.ForeignPartsOnly},
+		{"trusted", a.FromTrusted},
+		{"hd", a.HD},
+		{"ai", a.AITranslated},
+		{"mt", a.MachineTranslated},
+	} {
+		if f.v != nil && *f.v {
+			r = append(r, f.name)
+		}
+	}
+	if len(r) == 0 {
+		return "-"
+	}
+	return strings.Join(r, ",")
+}
+
+// Describes how long the session is valid for, such as "session valid for 23
+// hours".
+func validity(s *rest.Session) string {
+	if s == nil {
+		return "no session"
+	}
+	t, err := s.ParseToken()
+	if err != nil {
+		return "session validity unknown"
+	}
+	return t.Validity(time.Now())
+}
+
+func yesNo(v *bool) string {
+	if v == nil {
+		return "-"
+	}
+	if *v {
+		return "yes"
+	}
+	return "no"
+}
+
+// A flag that holds an ID.
+type idValue rest.ID
+
+func (v *idValue) String() string {
+	if v == nil || *v == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func (v *idValue) Set(s string) error {
+	s = strings.TrimPrefix(strings.ToLower(s), "tt")
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid id %q", s)
+	}
+	*v = idValue(n)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	envConfig    = "OPENSUBTITLES_CONFIG"
+	envAPIKey    = "OPENSUBTITLES_API_KEY"
+	envUsername  = "OPENSUBTITLES_USERNAME"
+	envPassword  = "OPENSUBTITLES_PASSWORD"
+	envBaseURL   = "OPENSUBTITLES_BASE_URL"
+	envUserAgent = "OPENSUBTITLES_USER_AGENT"
+)
+
+// The settings of the command, read from the config file and overridden by the
+// environment.
+type config struct {
+	APIKey    string `json:"api_key,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	BaseURL   string `json:"base_url,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// The path of the config file, which does not have to exist.
+	path string
+}
+
+// Returns the default path of the config file, in the config directory of the
+// user.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "opensubtitles", "config.json"), nil
+}
+
+// Reads the config file at the path, or at the one of the environment or the
+// default one if the path is empty, and applies the environment over it.
+func loadConfig(path string, getenv func (string) string) (*config, error) {
+	if path == "" {
+		path = getenv(envConfig)
+	}
+	if path == "" {
+		var err error
+		path, err = defaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := &config{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		err = json.Unmarshal(data, c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the config %q: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return nil, err
+	}
+	c.path = path
+
+	for _, o := range []struct {
+		name string
+		v    *string
+	}{
+		{envAPIKey, &c.APIKey},
+		{envUsername, &c.Username},
+		{envPassword, &c.Password},
+		{envBaseURL, &c.BaseURL},
+		{envUserAgent, &c.UserAgent},
+	} {
+		v := getenv(o.name)
+		if v != "" {
+			*o.v = v
+		}
+	}
+
+	return c, nil
+}
+
+// Returns the directory of the config file.
+func (c *config) dirname() string {
+	return filepath.Dir(c.path)
+}
+
+// Returns the path of the file that keeps the login session, next to the
+// config file.
+func (c *config) sessionPath() string {
+	return filepath.Join(c.dirname(), "session.json")
+}
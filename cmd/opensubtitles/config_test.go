@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_ReadsTheFileAndTheEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"api_key": "file", "username": "alice", "password": "secret"}`), 0600)
+	require.NoError(t, err)
+
+	env := map[string]string{envAPIKey: "env"}
+	c, err := loadConfig(path, func (k string) string {
+		return env[k]
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "env", c.APIKey)
+	assert.Equal(t, "alice", c.Username)
+	assert.Equal(t, "secret", c.Password)
+	assert.Equal(t, filepath.Join(filepath.Dir(path), "session.json"), c.sessionPath())
+}
+
+func TestLoadConfig_AllowsAMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	env := map[string]string{envConfig: path, envAPIKey: "key"}
+	c, err := loadConfig("", func (k string) string {
+		return env[k]
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "key", c.APIKey)
+	assert.Equal(t, path, c.path)
+}
+
+func TestLoadConfig_ReturnsAnErrorForAnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{`), 0600)
+	require.NoError(t, err)
+
+	_, err = loadConfig(path, func (string) string {
+		return ""
+	})
+	assert.ErrorContains(t, err, "cannot read the config")
+}
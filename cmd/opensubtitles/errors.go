@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opensubtitlescli/rest"
+)
+
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitAPIKey      = 3
+	exitAuth        = 4
+	exitQuota       = 5
+	exitRateLimit   = 6
+	exitNotFound    = 7
+	exitUnavailable = 8
+	exitInterrupted = 130
+)
+
+var (
+	errNoAPIKey    = errors.New("no api key")
+	errNotLoggedIn = errors.New("not logged in")
+)
+
+// Returned for a wrong use of the command, such as an unknown flag.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, a ...interface {}) error {
+	return &usageError{message: fmt.Sprintf(format, a...)}
+}
+
+// Returns the message to show for the error and the exit code that tells it
+// apart from the others.
+func describe(err error, c *config) (string, int) {
+	var (
+		usage       *usageError
+		circuit     *rest.CircuitOpenError
+		rateLimit   *rest.RateLimitError
+		quota       *rest.QuotaError
+		reserve     *rest.ReserveError
+		apiKey      *rest.APIKeyError
+		authToken   *rest.AuthTokenError
+		credentials *rest.CredentialsError
+		userAgent   *rest.UserAgentError
+		file        *rest.FileError
+		link        *rest.LinkError
+		response    *rest.ErrorResponse
+		path        *fs.PathError
+		network     net.Error
+		u           *url.Error
+	)
+
+	switch {
+	case errors.As(err, &usage):
+		return usage.message, exitUsage
+
+	case errors.Is(err, errNoAPIKey):
+		return fmt.Sprintf("no API key, set %s or api_key in %s", envAPIKey, c.path), exitAPIKey
+
+	case errors.Is(err, errNotLoggedIn):
+		return "not logged in, run opensubtitles login first", exitAuth
+
+	case errors.Is(err, context.Canceled):
+		return "interrupted", exitInterrupted
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the request timed out", exitUnavailable
+
+	case errors.Is(err, rest.ErrNoAPIKeys):
+		return "all the API keys are disabled", exitAPIKey
+
+	case errors.As(err, &circuit):
+		return "the API is unavailable, try again later", exitUnavailable
+
+	case rest.AsError(err, &rateLimit):
+		return "too many requests, try again in a few seconds", exitRateLimit
+
+	case rest.AsError(err, &quota):
+		if !quota.ResetTimeUTC.IsZero() {
+			d := time.Until(quota.ResetTimeUTC).Round(time.Minute)
+			return fmt.Sprintf("the download quota is exhausted, it resets in %s", d), exitQuota
+		}
+		return "the download quota is exhausted", exitQuota
+
+	case errors.As(err, &reserve):
+		return fmt.Sprintf("the download quota is down to the reserve of %d", reserve.Reserve), exitQuota
+
+	case rest.AsReportedError(err, &apiKey):
+		return fmt.Sprintf("the API key was rejected, check %s or api_key in %s", envAPIKey, c.path), exitAPIKey
+
+	case rest.AsError(err, &credentials):
+		return "the username or the password is wrong", exitAuth
+
+	case rest.AsReportedError(err, &authToken):
+		return "the session is no longer valid, run opensubtitles login again", exitAuth
+
+	case rest.AsReportedError(err, &userAgent):
+		return fmt.Sprintf("the user agent was rejected, check %s", envUserAgent), exitError
+
+	case rest.AsError(err, &file):
+		return "the file was not found", exitNotFound
+
+	case rest.AsError(err, &link):
+		return "the download link has expired, download the file again", exitNotFound
+
+	case errors.As(err, &response) && response.Response != nil:
+		m := responseMessage(response)
+		switch s := response.Response.StatusCode; {
+		case s == 401 && rest.AsError(err, &authToken):
+			return "this command needs a login, run opensubtitles login first", exitAuth
+		case s == 404:
+			return fmt.Sprintf("not found: %s", m), exitNotFound
+		case s >= 500:
+			return fmt.Sprintf("the API failed: %s", m), exitUnavailable
+		default:
+			return fmt.Sprintf("the request failed: %s", m), exitError
+		}
+
+	case errors.Is(err, fs.ErrExist) && errors.As(err, &path):
+		return fmt.Sprintf("%s already exists, pass -force to replace it", path.Path), exitError
+
+	case errors.Is(err, rest.ErrNoSubtitles):
+		return "no subtitles found", exitNotFound
+
+	case errors.As(err, &network) || errors.As(err, &u):
+		return fmt.Sprintf("cannot reach the API: %s", err), exitUnavailable
+
+	default:
+		return err.Error(), exitError
+	}
+}
+
+// Returns the messages of the server, without the ones added by the client for
+// the headers that the request did not have.
+func responseMessage(e *rest.ErrorResponse) string {
+	var m []string
+	for _, p := range strings.Split(e.Message, "; ") {
+		if p != "" && !strings.HasPrefix(p, "rest: ") {
+			m = append(m, p)
+		}
+	}
+	if len(m) > 0 {
+		return strings.Join(m, "; ")
+	}
+	if e.Response != nil {
+		return e.Response.Status
+	}
+	return "unknown error"
+}
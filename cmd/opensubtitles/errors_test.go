@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/opensubtitlescli/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe_MapsTheErrorsToExitCodes(t *testing.T) {
+	c := &config{path: "/home/u/.config/opensubtitles/config.json"}
+	res := &http.Response{StatusCode: 401, Status: "401 Unauthorized"}
+	unauthorized := &rest.ErrorResponse{
+		ResponseError: rest.ResponseError{Response: res, Message: "rest: authorization header is empty"},
+		Errors: []error{
+			&rest.AuthTokenError{Response: res, Message: "rest: authorization header is empty"},
+		},
+	}
+	expired := &rest.ErrorResponse{
+		ResponseError: rest.ResponseError{Response: res, Message: "Invalid token"},
+		Errors: []error{
+			&rest.AuthTokenError{Response: res, Message: "Invalid token"},
+		},
+	}
+	missing := &rest.ErrorResponse{
+		ResponseError: rest.ResponseError{Response: &http.Response{StatusCode: 404, Status: "404 Not Found"}},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		err     error
+		message string
+		code    int
+	}{
+		{"usage", usagef("download: expected one file id"), "download: expected one file id", exitUsage},
+		{"no api key", errNoAPIKey, "no API key, set OPENSUBTITLES_API_KEY or api_key in /home/u/.config/opensubtitles/config.json", exitAPIKey},
+		{"not logged in", errNotLoggedIn, "not logged in, run opensubtitles login first", exitAuth},
+		{"canceled", fmt.Errorf("get: %w", context.Canceled), "interrupted", exitInterrupted},
+		{"rate limit", &rest.RateLimitError{Message: "Throttle limit reached"}, "too many requests, try again in a few seconds", exitRateLimit},
+		{"quota", &rest.QuotaError{}, "the download quota is exhausted", exitQuota},
+		{"reserve", &rest.ReserveError{Reserve: 5}, "the download quota is down to the reserve of 5", exitQuota},
+		{"login required", unauthorized, "this command needs a login, run opensubtitles login first", exitAuth},
+		{"session expired", expired, "the session is no longer valid, run opensubtitles login again", exitAuth},
+		{"file", &rest.FileError{Message: "Invalid file_id"}, "the file was not found", exitNotFound},
+		{"not found", missing, "not found: 404 Not Found", exitNotFound},
+		{"exists", &os.PathError{Op: "open", Path: "a.srt", Err: os.ErrExist}, "a.srt already exists, pass -force to replace it", exitError},
+		{"no subtitles", rest.ErrNoSubtitles, "no subtitles found", exitNotFound},
+	} {
+		t.Run(tc.name, func (t *testing.T) {
+			m, code := describe(tc.err, c)
+			assert.Equal(t, tc.message, m)
+			assert.Equal(t, tc.code, code)
+		})
+	}
+}
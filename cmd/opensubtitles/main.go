@@ -0,0 +1,237 @@
+// Command opensubtitles searches and downloads subtitles from OpenSubtitles.
+//
+// The API key is read from the OPENSUBTITLES_API_KEY environment variable or
+// from the api_key of the config file, which defaults to opensubtitles/config.json
+// in the config directory of the user. The login session is kept next to the
+// config file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/opensubtitlescli/rest"
+)
+
+// Returned when the help of a command was asked for.
+var errHelp = errors.New("help")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func (ctx context.Context, e *env, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"login", "[-username name] [-password-stdin]", "Log in and keep the session", login},
+		{"logout", "", "Log out and forget the session", logout},
+		{"user", "", "Show the user of the session", user},
+		{"search", "subtitles|features [flags] [query]", "Search for subtitles or features", search},
+		{"popular", "[-features] [-languages list] [-type type]", "List the popular subtitles or features", popular},
+		{"latest", "[-languages list] [-type type]", "List the latest subtitles", latest},
+		{"languages", "", "List the subtitle languages", languages},
+		{"formats", "", "List the subtitle formats", formats},
+		{"download", "[-o path] [-format format] [-force] file-id", "Download a subtitle file", download},
+	}
+}
+
+// The state shared by the commands.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	config *config
+	json   bool
+
+	// The HTTP client of the API client. Defaults to http.DefaultClient.
+	httpClient *http.Client
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func (string) string) int {
+	fs := flag.NewFlagSet("opensubtitles", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", "", "")
+	asJSON := fs.Bool("json", false, "")
+
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(stdout)
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "opensubtitles: %s\n", err)
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	if args[0] == "help" {
+		printUsage(stdout)
+		return exitOK
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "opensubtitles: unknown command %q\n", args[0])
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath, getenv)
+	if err != nil {
+		fmt.Fprintf(stderr, "opensubtitles: %s\n", err)
+		return exitError
+	}
+
+	e := &env{
+		stdin: stdin,
+		stdout: stdout,
+		stderr: stderr,
+		config: cfg,
+		json: *asJSON,
+	}
+
+	err = cmd.run(ctx, e, args[1:])
+	if errors.Is(err, errHelp) {
+		return exitOK
+	}
+	if err != nil {
+		m, code := describe(err, cfg)
+		fmt.Fprintf(stderr, "opensubtitles: %s\n", m)
+		return code
+	}
+	return exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: opensubtitles [-config path] [-json] command [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	t := newTable(w)
+	for _, c := range commands {
+		t.row("  " + c.name, c.summary)
+	}
+	t.flush()
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "The API key is read from %s or from the api_key of the config file.\n", envAPIKey)
+	fmt.Fprintln(w, "Run opensubtitles command -h for the flags of a command.")
+}
+
+// Parses the flags of a command. The usage of the command is printed when its
+// help is asked for.
+func (e *env) parse(fs *flag.FlagSet, usage string, args []string) error {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(e.stdout, "Usage: opensubtitles %s %s\n", fs.Name(), usage)
+		fs.SetOutput(e.stdout)
+		fs.PrintDefaults()
+		return errHelp
+	}
+	if err != nil {
+		return usagef("%s: %s", fs.Name(), err)
+	}
+	return nil
+}
+
+// Returns a client configured with the API key, without a session.
+func (e *env) client() (*rest.Client, error) {
+	if e.config.APIKey == "" {
+		return nil, errNoAPIKey
+	}
+
+	c := rest.NewClient(e.httpClient)
+	c.APIKey = e.config.APIKey
+	if e.config.UserAgent != "" {
+		c.UserAgent = e.config.UserAgent
+	}
+	if e.config.BaseURL != "" {
+		b := e.config.BaseURL
+		if !strings.HasSuffix(b, "/") {
+			b += "/"
+		}
+		u, err := url.Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base url %q: %w", e.config.BaseURL, err)
+		}
+		c.BaseURL = u
+	}
+	return c, nil
+}
+
+// Returns the session manager that keeps the session next to the config file,
+// and logs in with the credentials of the config, if there are any.
+func (e *env) sessions() (*rest.SessionManager, error) {
+	c, err := e.client()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(e.config.dirname(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &rest.SessionManager{
+		Client: c,
+		Store: rest.NewFileTokenStore(e.config.sessionPath()),
+	}
+	if e.config.Username != "" && e.config.Password != "" {
+		m.Credentials = &rest.Credentials{
+			Username: e.config.Username,
+			Password: e.config.Password,
+		}
+	}
+	return m, nil
+}
+
+// Returns a client authenticated with the session, or with the API key only if
+// there is no session and none is required.
+func (e *env) authenticated(ctx context.Context, required bool) (*rest.Client, *rest.Session, error) {
+	m, err := e.sessions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := m.Store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil && m.Credentials == nil {
+		if required {
+			return nil, nil, errNotLoggedIn
+		}
+		return m.Client, nil, nil
+	}
+
+	return m.Authenticate(ctx)
+}
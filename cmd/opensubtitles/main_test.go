@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// Starts a test server and returns a function that runs the command against
+// it, with a config directory of its own.
+func setup(t *testing.T) (*http.ServeMux, func (stdin string, args ...string) *result, map[string]string) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	env := map[string]string{
+		envConfig: filepath.Join(t.TempDir(), "config.json"),
+		envAPIKey: "key",
+		envBaseURL: server.URL,
+	}
+	getenv := func (k string) string {
+		return env[k]
+	}
+
+	run := func (stdin string, args ...string) *result {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr, getenv)
+		return &result{stdout: stdout.String(), stderr: stderr.String(), code: code}
+	}
+	return mux, run, env
+}
+
+func token(exp time.Time) string {
+	claims := fmt.Sprintf(`{"user_id": 1, "exp": %d}`, exp.Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestRun_PrintsTheLanguagesAsATable(t *testing.T) {
+	mux, run, _ := setup(t)
+	mux.HandleFunc("/infos/languages", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("Api-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"language_code": "en", "language_name": "English"}, {"language_code": "pt-BR", "language_name": "Portuguese (BR)"}]}`)
+	})
+
+	r := run("", "languages")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, "CODE   NAME\nen     English\npt-BR  Portuguese (BR)\n", r.stdout)
+
+	r = run("", "-json", "languages")
+	assert.Equal(t, exitOK, r.code)
+	assert.Contains(t, r.stdout, `"language_code": "pt-BR"`)
+}
+
+func TestRun_SearchesForSubtitles(t *testing.T) {
+	mux, run, _ := setup(t)
+	mux.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "the matrix", q.Get("query"))
+		assert.Equal(t, "en,de", q.Get("languages"))
+		assert.Equal(t, "133093", q.Get("imdb_id"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"page": 1, "total_pages": 3, "total_count": 150, "data": [
+			{"attributes": {"language": "en", "release": "The.Matrix.1999", "ratings": 8.5, "download_count": 10, "hearing_impaired": true, "from_trusted": true, "files": [{"file_id": 7}]}}
+		]}`)
+	})
+
+	r := run("", "search", "subtitles", "-languages", "en,de", "-imdb", "tt0133093", "the", "matrix")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	lines := strings.Split(strings.TrimSpace(r.stdout), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"FILE", "ID", "LANG", "RELEASE", "RATING", "DOWNLOADS", "FLAGS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"7", "en", "The.Matrix.1999", "8.5", "10", "hi,trusted"}, strings.Fields(lines[1]))
+	assert.Equal(t, "page 1 of 3, 150 subtitles\n", r.stderr)
+}
+
+func TestRun_SearchesForFeatures(t *testing.T) {
+	mux, run, _ := setup(t)
+	mux.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "matrix", r.URL.Query().Get("query"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"attributes": {"feature_id": 1, "feature_type": "Movie", "title": "The Matrix", "year": "1999", "subtitles_count": 120}}]}`)
+	})
+
+	r := run("", "search", "features", "matrix")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Contains(t, r.stdout, "The Matrix")
+	assert.Contains(t, r.stdout, "120")
+}
+
+func TestRun_LogsInAndOut(t *testing.T) {
+	mux, run, _ := setup(t)
+	tok := token(time.Now().Add(24 * time.Hour))
+	mux.HandleFunc("/login", func (w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"username": "alice", "password": "secret"}`, string(data))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"token": %q, "user": {"username": "alice"}}`, tok)
+	})
+	mux.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer " + tok, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"username": "alice", "allowed_downloads": 20, "downloads_count": 5, "remaining_downloads": 15}}`)
+	})
+	logouts := 0
+	mux.HandleFunc("/logout", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE", r.Method)
+		logouts += 1
+	})
+
+	r := run("", "user")
+	assert.Equal(t, exitAuth, r.code)
+	assert.Equal(t, "opensubtitles: not logged in, run opensubtitles login first\n", r.stderr)
+
+	r = run("secret\n", "login", "-username", "alice", "-password-stdin")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, "logged in as alice, session valid for 23 hours\n", r.stdout)
+
+	r = run("", "user")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Contains(t, r.stdout, "5 of 20")
+	assert.Contains(t, r.stdout, "session valid for 23 hours")
+
+	r = run("", "logout")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, 1, logouts)
+
+	r = run("", "user")
+	assert.Equal(t, exitAuth, r.code)
+}
+
+func TestRun_DownloadsAFile(t *testing.T) {
+	mux, run, env := setup(t)
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"file_id": 7}`, string(data))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%s/file", "remaining": 9, "reset_time_utc": "2030-01-01T00:00:00Z"}`, env[envBaseURL])
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "subtitle")
+	})
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	r := run("", "download", "-o", path, "7")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, fmt.Sprintf("saved %s (8 bytes)\n", path), r.stdout)
+	assert.Equal(t, "9 downloads remaining\n", r.stderr)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	r = run("", "download", "-o", "-", "7")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, "subtitle", r.stdout)
+
+	r = run("", "download", "seven")
+	assert.Equal(t, exitUsage, r.code)
+}
+
+func TestRun_RefusesAnExistingFileBeforeTheDownload(t *testing.T) {
+	mux, run, env := setup(t)
+	n := 0
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%s/file"}`, env[envBaseURL])
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "subtitle")
+	})
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	err = os.Chdir(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func () {
+		os.Chdir(wd)
+	})
+	err = os.WriteFile("7.srt", []byte("existing"), 0644)
+	require.NoError(t, err)
+
+	r := run("", "download", "7")
+	assert.Equal(t, exitError, r.code)
+	assert.Equal(t, "opensubtitles: 7.srt already exists, pass -force to replace it\n", r.stderr)
+	assert.Equal(t, 0, n)
+
+	r = run("", "download", "-force", "7")
+	assert.Equal(t, exitOK, r.code, r.stderr)
+	assert.Equal(t, "saved 7.srt (8 bytes)\n", r.stdout)
+	assert.Equal(t, 1, n)
+}
+
+func TestRun_ExitsWithTheCodeOfTheError(t *testing.T) {
+	mux, run, env := setup(t)
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(406)
+		fmt.Fprint(w, `{"message": "You have downloaded your allowed 20 subtitles for 24h", "remaining": -1, "reset_time_utc": "2030-01-01T00:00:00Z"}`)
+	})
+	mux.HandleFunc("/infos/formats", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(503)
+		fmt.Fprint(w, `{"message": "Service unavailable"}`)
+	})
+
+	r := run("", "download", "-o", "-", "7")
+	assert.Equal(t, exitQuota, r.code)
+	assert.Contains(t, r.stderr, "the download quota is exhausted, it resets in")
+
+	r = run("", "formats")
+	assert.Equal(t, exitUnavailable, r.code)
+	assert.Equal(t, "opensubtitles: the API failed: Service unavailable\n", r.stderr)
+
+	r = run("", "unknown")
+	assert.Equal(t, exitUsage, r.code)
+	assert.Contains(t, r.stderr, `opensubtitles: unknown command "unknown"`)
+
+	r = run("", "languages", "-nope")
+	assert.Equal(t, exitUsage, r.code)
+
+	env[envAPIKey] = ""
+	r = run("", "languages")
+	assert.Equal(t, exitAPIKey, r.code)
+	assert.Contains(t, r.stderr, "no API key")
+}
+
+func TestRun_PrintsTheUsage(t *testing.T) {
+	_, run, _ := setup(t)
+
+	r := run("", "help")
+	assert.Equal(t, exitOK, r.code)
+	assert.Contains(t, r.stdout, "Usage: opensubtitles")
+	assert.Contains(t, r.stdout, "  download")
+
+	r = run("")
+	assert.Equal(t, exitUsage, r.code)
+	assert.Contains(t, r.stderr, "Usage: opensubtitles")
+
+	r = run("", "download", "-h")
+	assert.Equal(t, exitOK, r.code)
+	assert.Contains(t, r.stdout, "Usage: opensubtitles download")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opensubtitlescli/rest"
+)
+
+// Writes rows with aligned columns, under a header.
+type table struct {
+	w *tabwriter.Writer
+}
+
+func newTable(w io.Writer, header ...string) *table {
+	t := &table{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	if len(header) != 0 {
+		t.row(header...)
+	}
+	return t
+}
+
+func (t *table) row(cells ...string) {
+	fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+}
+
+func (t *table) flush() error {
+	return t.w.Flush()
+}
+
+func printJSON(w io.Writer, v interface {}) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func str(v *string) string {
+	if v == nil {
+		return "-"
+	}
+	return *v
+}
+
+func num(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func id(v *rest.ID) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func rating(v *float32) string {
+	if v == nil || *v == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(*v), 'f', 1, 32)
+}
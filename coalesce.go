@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Coalesces identical concurrent GET requests into one round-trip. The requests
+// are identical if they have the same URL and are sent with the same
+// credentials. Every caller gets its own copy of the response, so the result
+// is decoded separately for each of them.
+type Coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct {}
+	res  *Response
+	body []byte
+	err  error
+
+	// Reports whether the request in flight ended without a result, because
+	// its caller panicked.
+	abandoned bool
+}
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{calls: map[string]*coalescedCall{}}
+}
+
+// Sends the request with fn, unless an identical one is in flight, in which
+// case it waits for its response. The caller that sends the request gets the
+// response itself, so what it has decoded along with it is kept, and the
+// waiting callers get copies. If the request in flight fails because its caller
+// gave up, or its caller panics, the waiting callers send their own.
+func (g *Coalescer) do(ctx context.Context, key string, fn func () (*Response, error)) (*Response, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		c = &coalescedCall{done: make(chan struct {})}
+		g.calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		return g.lead(key, c, fn)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+	}
+
+	if c.abandoned || errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded) {
+		return fn()
+	}
+	return c.result()
+}
+
+// Sends the request in flight and shares its result with the waiting callers.
+// The call is removed even if fn panics, so the waiting callers never block.
+func (g *Coalescer) lead(key string, c *coalescedCall, fn func () (*Response, error)) (*Response, error) {
+	c.abandoned = true
+	defer func () {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	res, err := fn()
+	if res != nil && res.Response != nil && res.Body != nil {
+		var rErr error
+		c.body, rErr = readBody(res.Body)
+		res.Body.Close()
+		res.Body = newBufferedBody(c.body)
+		if rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+	c.res, c.err = res, err
+	if res != nil && res.Response != nil {
+		// The caller may change the response it gets, so the others get
+		// copies of a snapshot.
+		c.res, _ = c.result()
+	}
+	c.abandoned = false
+
+	return res, err
+}
+
+// Returns a copy of the response with its own headers and body, and a copy of
+// the error that refers to it.
+func (c *coalescedCall) result() (*Response, error) {
+	if c.res == nil || c.res.Response == nil {
+		return c.res, c.err
+	}
+
+	r := *c.res.Response
+	r.Header = c.res.Header.Clone()
+	r.Body = newBufferedBody(c.body)
+
+	res := *c.res
+	res.Response = &r
+	return &res, withResponse(c.err, &r)
+}
+
+// Returns a copy of the error of CheckResponse that refers to the response.
+// Other errors are returned as they are.
+func withResponse(err error, r *http.Response) error {
+	switch e := err.(type) {
+	case *ErrorResponse:
+		cp := &ErrorResponse{
+			ResponseError: ResponseError{Response: r, Message: e.Message},
+		}
+		for _, ee := range e.Errors {
+			cp.Errors = append(cp.Errors, withResponse(ee, r))
+		}
+		return cp
+	case *ResponseError:
+		return &ResponseError{Response: r, Message: e.Message}
+	case *UserAgentError:
+		return &UserAgentError{Response: r, Message: e.Message}
+	case *APIKeyError:
+		return &APIKeyError{Response: r, Message: e.Message}
+	case *AuthTokenError:
+		return &AuthTokenError{Response: r, Message: e.Message}
+	case *CredentialsError:
+		return &CredentialsError{Response: r, Message: e.Message}
+	case *FileError:
+		return &FileError{Response: r, Message: e.Message}
+	case *LinkError:
+		return &LinkError{Response: r, Message: e.Message}
+	case *RateLimitError:
+		return &RateLimitError{Response: r, Message: e.Message}
+	case *QuotaError:
+		return &QuotaError{
+			ResponseError: ResponseError{Response: r, Message: e.Message},
+			Quota: e.Quota,
+		}
+	default:
+		return err
+	}
+}
+
+// Returns the key of a request that can be coalesced, or an empty string if it
+// cannot.
+func (c *Client) coalesceKey(req *http.Request) string {
+	if req.Method != "GET" || (req.Body != nil && req.Body != http.NoBody) {
+		return ""
+	}
+	return strings.Join([]string{
+		req.Method,
+		req.URL.String(),
+		req.Header.Get(apiKeyHeader),
+		req.Header.Get("User-Agent"),
+		req.Header.Get("Authorization"),
+		c.authToken,
+	}, "\n")
+}
@@ -0,0 +1,272 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescer_SharesOneRoundTripBetweenIdenticalRequests(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	var n int32
+	entered := make(chan struct {})
+	release := make(chan struct {})
+	mux.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1"}], "total_count": 1}`)
+	})
+
+	client.Coalescer = NewCoalescer()
+	ctx := context.Background()
+	p := &FeaturesSearchParameters{Query: "hi"}
+
+	const k = 5
+	var wg sync.WaitGroup
+	entities := make([][]*FeatureEntity, k)
+	responses := make([]*Response, k)
+	search := func (i int) {
+		defer wg.Done()
+		a, res, err := client.Features.Search(ctx, p)
+		assert.NoError(t, err)
+		entities[i], responses[i] = a, res
+	}
+
+	wg.Add(1)
+	go search(0)
+	<-entered
+	for i := 1; i < k; i += 1 {
+		wg.Add(1)
+		go search(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+	for i := 0; i < k; i += 1 {
+		require.Len(t, entities[i], 1)
+		assert.Equal(t, AllocateID(1), entities[i][0].ID)
+		assert.Equal(t, 1, responses[i].Pagination.TotalCount)
+		assert.Equal(t, "application/json", responses[i].Header.Get("Content-Type"))
+	}
+
+	entities[0][0].ID = AllocateID(2)
+	responses[0].Header.Set("X-Changed", "1")
+	assert.Equal(t, AllocateID(1), entities[1][0].ID)
+	assert.Empty(t, responses[1].Header.Get("X-Changed"))
+
+	_, _, err := client.Features.Search(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&n))
+}
+
+func TestCoalescer_StartsASpanForEveryCaller(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	var n int32
+	entered := make(chan struct {})
+	release := make(chan struct {})
+	mux.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": []}`)
+	})
+
+	in := newTestInstrumentation()
+	client.Instrumentation = in
+	client.Coalescer = NewCoalescer()
+	ctx := context.Background()
+	p := &FeaturesSearchParameters{Query: "hi"}
+
+	const k = 3
+	var wg sync.WaitGroup
+	search := func () {
+		defer wg.Done()
+		_, _, err := client.Features.Search(ctx, p)
+		assert.NoError(t, err)
+	}
+
+	wg.Add(1)
+	go search()
+	<-entered
+	for i := 1; i < k; i += 1 {
+		wg.Add(1)
+		go search()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+	require.Len(t, in.starts, k)
+	require.Len(t, in.ends, k)
+	coalesced := 0
+	for _, e := range in.ends {
+		assert.Equal(t, 200, e.Status)
+		if e.Coalesced {
+			coalesced += 1
+		}
+	}
+	assert.Equal(t, k - 1, coalesced)
+	assert.Equal(t, int64(1), in.counters[MetricRequests])
+}
+
+func TestCoalescer_KeepsTheUsersApart(t *testing.T) {
+	client := NewClient(nil)
+	req, err := client.NewRequest("GET", "https://example.com/features?query=hi", nil)
+	require.NoError(t, err)
+
+	a := client.WithAuthToken("a")
+	b := client.WithAuthToken("b")
+	assert.NotEqual(t, a.coalesceKey(req), b.coalesceKey(req))
+	assert.Equal(t, a.coalesceKey(req), a.WithAuthToken("a").coalesceKey(req))
+
+	ctx := ContextWithAPIKey(context.Background(), "other")
+	assert.NotEqual(t, a.coalesceKey(req), a.coalesceKey(applyContextCredentials(ctx, req)))
+
+	req, err = client.NewRequest("POST", "https://example.com/download", nil)
+	require.NoError(t, err)
+	assert.Empty(t, client.coalesceKey(req))
+}
+
+func TestCoalescer_RetriesIfTheCallerInFlightGivesUp(t *testing.T) {
+	g := NewCoalescer()
+
+	entered := make(chan struct {})
+	release := make(chan struct {})
+	go func () {
+		_, err := g.do(context.Background(), "k", func () (*Response, error) {
+			close(entered)
+			<-release
+			return nil, context.Canceled
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	}()
+	<-entered
+
+	done := make(chan struct {})
+	go func () {
+		defer close(done)
+		res, err := g.do(context.Background(), "k", func () (*Response, error) {
+			return &Response{}, nil
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-done
+}
+
+func TestCoalescer_GivesEveryCallerItsOwnError(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	entered := make(chan struct {})
+	release := make(chan struct {})
+	var n int32
+	mux.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"message": "Service unavailable"}`)
+	})
+
+	client.Coalescer = NewCoalescer()
+	ctx := context.Background()
+	p := &FeaturesSearchParameters{Query: "hi"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func (i int) {
+			defer wg.Done()
+			if i > 0 {
+				<-entered
+			}
+			_, _, errs[i] = client.Features.Search(ctx, p)
+		}(i)
+	}
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+	seen := map[*http.Response]bool{}
+	for _, err := range errs {
+		var er *ErrorResponse
+		require.ErrorAs(t, err, &er)
+		assert.False(t, seen[er.Response])
+		seen[er.Response] = true
+		for _, e := range er.Errors {
+			var re *ResponseError
+			if errors.As(e, &re) {
+				assert.Same(t, er.Response, re.Response)
+			}
+		}
+		data, rErr := io.ReadAll(er.Response.Body)
+		require.NoError(t, rErr)
+		assert.Equal(t, `{"message": "Service unavailable"}`, string(data))
+	}
+}
+
+func TestCoalescer_ReleasesTheWaitingCallersIfTheCallerInFlightPanics(t *testing.T) {
+	g := NewCoalescer()
+
+	entered := make(chan struct {})
+	release := make(chan struct {})
+	go func () {
+		defer func () {
+			assert.Equal(t, "boom", recover())
+		}()
+		g.do(context.Background(), "k", func () (*Response, error) {
+			close(entered)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-entered
+
+	done := make(chan struct {})
+	go func () {
+		defer close(done)
+		res, err := g.do(context.Background(), "k", func () (*Response, error) {
+			return &Response{}, nil
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the waiting caller is blocked")
+	}
+	assert.Empty(t, g.calls)
+}
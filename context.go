@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	authTokenContextKey contextKey = iota
+	apiKeyContextKey
+	userAgentContextKey
+	subtitleIDContextKey
+)
+
+// Returns a copy of the context that overrides the auth token of the client for
+// the requests made with it.
+func ContextWithAuthToken(ctx context.Context, t string) context.Context {
+	return context.WithValue(ctx, authTokenContextKey, t)
+}
+
+// Returns a copy of the context that overrides the API key of the client for
+// the requests made with it.
+func ContextWithAPIKey(ctx context.Context, k string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, k)
+}
+
+// Returns a copy of the context that overrides the User-Agent of the client for
+// the requests made with it.
+func ContextWithUserAgent(ctx context.Context, ua string) context.Context {
+	return context.WithValue(ctx, userAgentContextKey, ua)
+}
+
+// Returns a copy of the context that records the downloads made with it under
+// the subtitle in the download ledger of the client.
+func ContextWithSubtitleID(ctx context.Context, id ID) context.Context {
+	return context.WithValue(ctx, subtitleIDContextKey, id)
+}
+
+func subtitleIDFrom(ctx context.Context) ID {
+	id, _ := ctx.Value(subtitleIDContextKey).(ID)
+	return id
+}
+
+// Applies the credentials of the context to a copy of the request. Returns the
+// request itself if the context does not override anything.
+func applyContextCredentials(ctx context.Context, req *http.Request) *http.Request {
+	t, tok := ctx.Value(authTokenContextKey).(string)
+	k, kok := ctx.Value(apiKeyContextKey).(string)
+	ua, uaok := ctx.Value(userAgentContextKey).(string)
+	if !tok && !kok && !uaok {
+		return req
+	}
+
+	req = req.Clone(ctx)
+	if tok {
+		req.Header.Set("Authorization", "Bearer " + t)
+	}
+	if kok {
+		req.Header.Set(apiKeyHeader, k)
+	}
+	if uaok {
+		req.Header.Set("User-Agent", ua)
+	}
+	return req
+}
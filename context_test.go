@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBareDo_AppliesTheCredentialsOfTheContext(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	var h http.Header
+	m.HandleFunc("/hi", func (w http.ResponseWriter, r *http.Request) {
+		h = r.Header
+	})
+
+	c.APIKey = "client-key"
+	c = c.WithAuthToken("client-token")
+
+	u, err := c.NewURL("hi", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = c.BareDo(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer client-token", h.Get("Authorization"))
+	assert.Equal(t, "client-key", h.Get(apiKeyHeader))
+	assert.Equal(t, defaultUserAgent, h.Get("User-Agent"))
+
+	ctx = ContextWithAuthToken(ctx, "call-token")
+	ctx = ContextWithAPIKey(ctx, "call-key")
+	ctx = ContextWithUserAgent(ctx, "app v1.0.0")
+	_, err = c.BareDo(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer call-token", h.Get("Authorization"))
+	assert.Equal(t, "call-key", h.Get(apiKeyHeader))
+	assert.Equal(t, "app v1.0.0", h.Get("User-Agent"))
+
+	assert.Equal(t, "client-key", req.Header.Get(apiKeyHeader))
+}
@@ -0,0 +1,375 @@
+package rest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// The value that Do decodes the response into. Do hands it down to newResponse
+// through the request handler, so the body is decoded in the same pass as the
+// pagination and the quota.
+type decodeTarget struct {
+	v   interface {}
+	res *Response
+	err error
+}
+
+// Returns the target, unless it is nil or has been filled already, such as by
+// a request that a key pool retried.
+func (t *decodeTarget) pending() *decodeTarget {
+	if t == nil || t.res != nil {
+		return nil
+	}
+	return t
+}
+
+// A body that has been read into memory. It can be read again by CheckResponse
+// without another copy.
+type bufferedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newBufferedBody(data []byte) *bufferedBody {
+	return &bufferedBody{Reader: bytes.NewReader(data), data: data}
+}
+
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// Reads the body, preferring the content of a buffered body over a copy.
+func readBody(r io.Reader) ([]byte, error) {
+	b, ok := r.(*bufferedBody)
+	if ok && b.Len() == len(b.data) {
+		return b.data, nil
+	}
+	return io.ReadAll(r)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decodes a JSON body into the value and takes the pagination and the quota
+// from it, reading the members of the top-level object once: the members of
+// the pagination and the quota go to their structs, and the others straight to
+// the fields of the value. The value may be nil. A value that encoding/json
+// must see whole, such as one with its own unmarshaler, an embedded struct or
+// a field with an option, is decoded whole, and the metadata are taken from
+// the bytes read.
+//
+// The bytes read are returned, since the callers of BareDo read the body again.
+// The error of the value is returned, the metadata are decoded as well as
+// possible, the same way json.Unmarshal does.
+func decodeResponse(r io.Reader, v interface {}, p *Pagination, q *Quota) ([]byte, error) {
+	var b bytes.Buffer
+	var err error
+
+	d := json.NewDecoder(io.TeeReader(r, &b))
+	t, ok := newObjectTarget(v)
+	if ok {
+		err = t.decode(d, p, q)
+	} else {
+		err = d.Decode(v)
+		if err == io.EOF {
+			// An empty body leaves the value as it is.
+			err = nil
+		}
+	}
+
+	// The decoder stops at the end of the value, so the rest of the body is
+	// kept as well.
+	_, rErr := io.Copy(&b, r)
+	if rErr != nil && err == nil {
+		err = rErr
+	}
+
+	data := b.Bytes()
+	if !ok {
+		decodeMeta(data, p, q)
+	}
+	return data, err
+}
+
+// Decodes only the pagination and the quota, ignoring the errors.
+func decodeMeta(data []byte, p *Pagination, q *Quota) {
+	m := struct {
+		*Pagination
+		*Quota
+	}{p, q}
+	err := json.Unmarshal(data, &m)
+	if err == nil || isTypeError(err) {
+		return
+	}
+
+	// A member that fails to decode, such as a malformed time, stops the
+	// decoding, so the metadata are decoded apart.
+	*p = Pagination{}
+	*q = Quota{}
+	json.Unmarshal(data, p)
+	json.Unmarshal(data, q)
+}
+
+func isTypeError(err error) bool {
+	var te *json.UnmarshalTypeError
+	return errors.As(err, &te)
+}
+
+// A value whose top-level members can be decoded one by one: nil, or a pointer
+// to a struct, through any number of pointers, with plain exported fields.
+type objectTarget struct {
+	v      reflect.Value
+	typ    reflect.Type
+	fields []objectField
+}
+
+type objectField struct {
+	name  string
+	index int
+}
+
+// Returns the target of the value, or false if encoding/json must decode it
+// whole.
+func newObjectTarget(v interface {}) (*objectTarget, bool) {
+	t := &objectTarget{}
+	if v == nil {
+		return t, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, false
+	}
+	typ := rv.Type()
+	for typ.Kind() == reflect.Ptr {
+		if typ.Implements(jsonUnmarshalerType) || typ.Implements(textUnmarshalerType) {
+			return nil, false
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < typ.NumField(); i += 1 {
+		f := typ.Field(i)
+		if f.Anonymous {
+			return nil, false
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := f.Name
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		for _, o := range parts[1:] {
+			if o != "omitempty" {
+				return nil, false
+			}
+		}
+		if seen[name] {
+			// encoding/json drops the fields that share a name.
+			return nil, false
+		}
+		seen[name] = true
+		t.fields = append(t.fields, objectField{name: name, index: i})
+	}
+
+	t.v = rv
+	t.typ = typ
+	return t, true
+}
+
+// Returns the field the member is decoded into, matching the name exactly, or
+// else without regard to case, like encoding/json.
+func (t *objectTarget) field(key string) (objectField, bool) {
+	for _, f := range t.fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range t.fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return objectField{}, false
+}
+
+// Returns the struct the members are decoded into, allocating the pointers
+// that lead to it.
+func (t *objectTarget) object() reflect.Value {
+	v := t.v
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// Sets the value that null decodes into: the outermost pointer that the
+// target points to is set to nil.
+func (t *objectTarget) null() {
+	if !t.v.IsValid() {
+		return
+	}
+	e := t.v.Elem()
+	if e.Kind() == reflect.Ptr {
+		e.Set(reflect.Zero(e.Type()))
+	}
+}
+
+func (t *objectTarget) decode(d *json.Decoder, p *Pagination, q *Quota) error {
+	tok, err := d.Token()
+	if err == io.EOF {
+		// An empty body leaves the value as it is.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		t.null()
+		return nil
+	}
+	if tok != json.Delim('{') {
+		if !t.v.IsValid() {
+			return nil
+		}
+		// encoding/json allocates the pointers before it finds the mismatch.
+		t.object()
+		return &json.UnmarshalTypeError{Value: jsonKind(tok), Type: t.typ, Offset: d.InputOffset()}
+	}
+
+	var s reflect.Value
+	if t.v.IsValid() {
+		s = t.object()
+	}
+
+	var typeErr error
+	var raw json.RawMessage
+	for d.More() {
+		tok, err = d.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+
+		var dst interface {}
+		if s.IsValid() {
+			f, ok := t.field(key)
+			if ok {
+				dst = s.Field(f.index).Addr().Interface()
+			}
+		}
+
+		meta := metaField(key, p, q)
+		switch {
+		case meta != nil && dst != nil:
+			// The member belongs to both, so it is read once and decoded
+			// twice. The members of the metadata are small.
+			raw = raw[:0]
+			err = d.Decode(&raw)
+			if err == nil {
+				json.Unmarshal(raw, meta)
+				err = json.Unmarshal(raw, dst)
+			}
+		case meta != nil:
+			err = d.Decode(meta)
+			if err != nil && isTypeError(err) {
+				err = nil
+			}
+		case dst != nil:
+			err = d.Decode(dst)
+		default:
+			raw = raw[:0]
+			err = d.Decode(&raw)
+		}
+
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			// Like json.Unmarshal, the first type error is returned once the
+			// rest has been decoded.
+			if te.Field == "" {
+				te.Field = key
+			} else {
+				te.Field = key + "." + te.Field
+			}
+			te.Struct = t.typ.Name()
+			if typeErr == nil {
+				typeErr = te
+			}
+			err = nil
+		}
+		if err != nil {
+			if meta != nil && dst == nil {
+				// A malformed member of the metadata, such as a time, is
+				// ignored.
+				continue
+			}
+			return err
+		}
+	}
+
+	_, err = d.Token()
+	if err != nil {
+		return err
+	}
+	return typeErr
+}
+
+// Returns the field of the pagination or the quota that the member is decoded
+// into, or nil.
+func metaField(key string, p *Pagination, q *Quota) interface {} {
+	switch key {
+	case "page":
+		return &p.Page
+	case "per_page":
+		return &p.PerPage
+	case "total_count":
+		return &p.TotalCount
+	case "total_pages":
+		return &p.TotalPages
+	case "remaining":
+		return &q.Remaining
+	case "requests":
+		return &q.Requests
+	case "reset_time":
+		return &q.ResetTime
+	case "reset_time_utc":
+		return &q.ResetTimeUTC
+	}
+	return nil
+}
+
+// Returns the kind of the JSON value that starts with the token, the way
+// encoding/json names it in a type error.
+func jsonKind(tok json.Token) string {
+	switch tok.(type) {
+	case json.Delim:
+		return "array"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	}
+	return "value"
+}
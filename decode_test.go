@@ -0,0 +1,421 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeResponse_DecodesTheValueAndTheMetadata(t *testing.T) {
+	data := []byte(`{
+		"total_pages": 2,
+		"total_count": 3,
+		"per_page": 2,
+		"page": 1,
+		"data": [{"id": "1"}, {"id": "2"}],
+		"extra": {"nested": [1, {"a": null}]}
+	}`)
+
+	var r *subtitlesResponse
+	var p Pagination
+	var q Quota
+	_, err := decodeResponse(bytes.NewReader(data), &r, &p, &q)
+	require.NoError(t, err)
+	assert.Equal(t, Pagination{Page: 1, PerPage: 2, TotalCount: 3, TotalPages: 2}, p)
+	assert.Equal(t, Quota{}, q)
+	require.Len(t, r.Data, 2)
+	assert.Equal(t, AllocateID(2), r.Data[1].ID)
+}
+
+func TestDecodeResponse_DecodesTheSharedMembersIntoBoth(t *testing.T) {
+	data := []byte(`{
+		"link": "https://example.com/",
+		"remaining": 5,
+		"requests": 15,
+		"reset_time_utc": "2023-01-01T00:00:00.000Z"
+	}`)
+
+	type download struct {
+		Link      *string `json:"link"`
+		Remaining *int    `json:"remaining"`
+	}
+
+	r := &download{}
+	var p Pagination
+	var q Quota
+	_, err := decodeResponse(bytes.NewReader(data), r, &p, &q)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/", *r.Link)
+	assert.Equal(t, 5, *r.Remaining)
+	assert.Equal(t, 5, q.Remaining)
+	assert.Equal(t, 15, q.Requests)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), q.ResetTimeUTC)
+}
+
+func TestDecodeResponse_UsesTheUnmarshalerOfTheValue(t *testing.T) {
+	data := []byte(`{"token": "xxx", "user": {"vip": true}, "remaining": 3}`)
+
+	var l *Login
+	var p Pagination
+	var q Quota
+	_, err := decodeResponse(bytes.NewReader(data), &l, &p, &q)
+	require.NoError(t, err)
+	assert.Equal(t, "xxx", *l.Token)
+	assert.Equal(t, vipBaseURL, l.ClientBaseURL)
+	assert.Equal(t, 3, q.Remaining)
+}
+
+func TestDecodeResponse_ReportsTheTypeErrorsOfTheValueOnly(t *testing.T) {
+	data := []byte(`{"page": "one", "total_count": 2, "data": "none"}`)
+
+	var r *subtitlesResponse
+	var p Pagination
+	var q Quota
+	_, err := decodeResponse(bytes.NewReader(data), &r, &p, &q)
+	var te *json.UnmarshalTypeError
+	require.ErrorAs(t, err, &te)
+	assert.Equal(t, "data", te.Field)
+	assert.Equal(t, Pagination{TotalCount: 2}, p)
+
+	_, err = decodeResponse(bytes.NewReader(data), nil, &p, &q)
+	assert.NoError(t, err)
+}
+
+func TestDecodeResponse_MatchesTheMembersLikeEncodingJSON(t *testing.T) {
+	type Inner struct {
+		A int `json:"a"`
+		B int
+	}
+	type outer struct {
+		*Inner
+		A      string `json:"a"`
+		C      int    `json:"-"`
+		hidden int
+	}
+
+	data := []byte(`{"a": "x", "b": 2, "C": 3, "hidden": 4}`)
+
+	var e outer
+	err := json.Unmarshal(data, &e)
+	require.NoError(t, err)
+
+	var a outer
+	_, err = decodeResponse(bytes.NewReader(data), &a, &Pagination{}, &Quota{})
+	require.NoError(t, err)
+	assert.Equal(t, e, a)
+}
+
+func TestDecodeResponse_DecodesTheMembersOneByOneLikeEncodingJSON(t *testing.T) {
+	type inner struct {
+		N int `json:"n"`
+	}
+	type value struct {
+		Name   string            `json:"name"`
+		Inner  *inner            `json:"inner"`
+		List   []int             `json:"list,omitempty"`
+		Map    map[string]string `json:"map"`
+		Plain  int
+		Hidden int `json:"-"`
+	}
+
+	for _, data := range []string{
+		`{"name": "a", "inner": {"n": 1}, "list": [1, 2], "map": {"k": "v"}, "plain": 3, "Hidden": 4, "unknown": [{}], "page": 2}`,
+		`{"NAME": "b", "Inner": null}`,
+		`{"inner": {"n": "x"}, "name": "c", "list": {}}`,
+		`null`,
+		`[1, 2]`,
+		``,
+	} {
+		var e *value
+		eErr := json.Unmarshal([]byte(data), &e)
+		if data == "" {
+			eErr = nil
+		}
+
+		var a *value
+		var p Pagination
+		_, err := decodeResponse(strings.NewReader(data), &a, &p, &Quota{})
+		assert.Equal(t, e, a, data)
+		if eErr == nil {
+			assert.NoError(t, err, data)
+			continue
+		}
+		var ete, ate *json.UnmarshalTypeError
+		require.ErrorAs(t, eErr, &ete, data)
+		require.ErrorAs(t, err, &ate, data)
+		assert.Equal(t, ete.Field, ate.Field, data)
+		assert.Equal(t, ete.Value, ate.Value, data)
+		assert.Equal(t, ete.Type, ate.Type, data)
+	}
+}
+
+func TestDecodeResponse_IgnoresAMalformedMemberOfTheMetadata(t *testing.T) {
+	data := []byte(`{"reset_time_utc": "soon", "remaining": 3, "data": [{"id": "1"}]}`)
+
+	var r *subtitlesResponse
+	var p Pagination
+	var q Quota
+	_, err := decodeResponse(bytes.NewReader(data), &r, &p, &q)
+	require.NoError(t, err)
+	assert.Equal(t, Quota{Remaining: 3}, q)
+	require.Len(t, r.Data, 1)
+}
+
+func TestDecodeResponse_KeepsTheWholeBody(t *testing.T) {
+	data := []byte(`{"data": []} {"page": 2}`)
+
+	var r *subtitlesResponse
+	var p Pagination
+	var q Quota
+	b, err := decodeResponse(bytes.NewReader(data), &r, &p, &q)
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestDo_ReturnsAnErrorForAnEmbeddedPointerToAnUnexportedStruct(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"a": 1, "page": 2}`)
+	})
+
+	type inner struct {
+		A int `json:"a"`
+	}
+	type outer struct {
+		*inner
+	}
+
+	u, err := c.NewURL("", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	var e outer
+	eErr := json.Unmarshal([]byte(`{"a": 1}`), &e)
+	require.Error(t, eErr)
+
+	var a outer
+	res, err := c.Do(context.Background(), req, &a)
+	assert.EqualError(t, err, eErr.Error())
+	assert.Equal(t, 2, res.Pagination.Page)
+}
+
+func TestDo_HonorsTheStringOption(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"count": "42"}`)
+	})
+
+	u, err := c.NewURL("", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	var a struct {
+		Count int `json:"count,string"`
+	}
+	_, err = c.Do(context.Background(), req, &a)
+	require.NoError(t, err)
+	assert.Equal(t, 42, a.Count)
+}
+
+func TestDo_DecodesTheBodyOnce(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1"}], "page": 2}`)
+	})
+
+	var seen *Response
+	c.Use(func (next RequestHandler) RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*Response, error) {
+			res, err := next(ctx, req)
+			seen = res
+			return res, err
+		}
+	})
+
+	u, err := c.NewURL("", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	var r *featuresResponse
+	res, err := c.Do(context.Background(), req, &r)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Pagination.Page)
+	assert.Equal(t, AllocateID(1), r.Data[0].ID)
+
+	// The body is still there for the middleware.
+	data, err := io.ReadAll(seen.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"data": [{"id": "1"}], "page": 2}`, string(data))
+}
+
+func TestDo_DecodesAReplacedResponse(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1"}]}`)
+	})
+
+	c.Use(func (next RequestHandler) RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*Response, error) {
+			res, err := next(ctx, req)
+			if err != nil {
+				return res, err
+			}
+			r := *res.Response
+			r.Body = io.NopCloser(strings.NewReader(`{"data": [{"id": "2"}]}`))
+			return &Response{Response: &r}, nil
+		}
+	})
+
+	u, err := c.NewURL("", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	var r *featuresResponse
+	_, err = c.Do(context.Background(), req, &r)
+	require.NoError(t, err)
+	require.Len(t, r.Data, 1)
+	assert.Equal(t, AllocateID(2), r.Data[0].ID)
+}
+
+func searchPage(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"total_pages": 10, "total_count": 500, "per_page": 50, "page": 1, "data": [`)
+	for i := 0; i < n; i += 1 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{
+			"id": "%d",
+			"type": "subtitle",
+			"attributes": {
+				"subtitle_id": "%d",
+				"language": "en",
+				"download_count": 1234,
+				"hearing_impaired": false,
+				"fps": 23.976,
+				"votes": 3,
+				"ratings": 7.5,
+				"release": "Some.Movie.2009.1080p.BluRay.x264-GROUP",
+				"comments": "Synced and corrected by someone who cares a lot about subtitles.",
+				"upload_date": "2023-01-01T00:00:00Z",
+				"url": "https://www.opensubtitles.com/en/subtitles/some-movie",
+				"feature_details": {"feature_id": 1, "feature_type": "Movie", "year": 2009, "title": "Some Movie", "imdb_id": 1},
+				"files": [{"file_id": %d, "cd_number": 1, "file_name": "Some.Movie.2009.1080p.BluRay.x264-GROUP.srt"}]
+			}
+		}`, i, i, i)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
+
+// Decodes the response the way it was decoded before: newResponse unmarshaled
+// the body into the pagination and the quota, and Do decoded it once more.
+func legacyDecode(data []byte) (*subtitlesResponse, Pagination, Quota, error) {
+	var p Pagination
+	var q Quota
+	buf := bytes.NewBuffer(append([]byte(nil), data...))
+	all, _ := io.ReadAll(buf)
+	if json.Unmarshal(all, &p) != nil {
+		p = Pagination{}
+	}
+	if json.Unmarshal(all, &q) != nil {
+		q = Quota{}
+	}
+	var r *subtitlesResponse
+	err := json.NewDecoder(bytes.NewBuffer(all)).Decode(&r)
+	return r, p, q, err
+}
+
+func TestDecodeResponse_MatchesTheLegacyDecoding(t *testing.T) {
+	data := searchPage(5)
+
+	e, ep, eq, err := legacyDecode(data)
+	require.NoError(t, err)
+
+	var a *subtitlesResponse
+	var ap Pagination
+	var aq Quota
+	_, err = decodeResponse(bytes.NewReader(data), &a, &ap, &aq)
+	require.NoError(t, err)
+
+	assert.Equal(t, e, a)
+	assert.Equal(t, ep, ap)
+	assert.Equal(t, eq, aq)
+}
+
+func BenchmarkDecodeResponse_SearchPage(b *testing.B) {
+	data := searchPage(50)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		var r *subtitlesResponse
+		var p Pagination
+		var q Quota
+		_, err := decodeResponse(bytes.NewReader(data), &r, &p, &q)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLegacyDecode_SearchPage(b *testing.B) {
+	data := searchPage(50)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		_, _, _, err := legacyDecode(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDo_SearchPage(b *testing.B) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	data := searchPage(50)
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	ctx := context.Background()
+	p := &SubtitlesSearchParameters{}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		_, _, err := c.Subtitles.Search(ctx, p)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package rest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const checksumExtension = ".sha256"
+
+type DownloadToPathParameters struct {
+	// Replaces an existing file. An existing file is never replaced without it,
+	// even one that is created while the content is downloaded.
+	Overwrite bool
+
+	// The mode of a new file. Defaults to 0644. A replaced file keeps its mode.
+	Mode fs.FileMode
+
+	// The modification time of the file, such as the upload date of the
+	// subtitle. A replaced file keeps its modification time if it is zero.
+	ModTime time.Time
+
+	// Leaves out the checksum file, such as for a one-off download that later
+	// runs do not check. FileUnchanged reports such a file as changed.
+	SkipChecksum bool
+}
+
+// Describes the file written by DownloadToPath.
+type DownloadedFile struct {
+	Path   string
+	SHA256 string
+	Size   int64
+
+	// Reports whether the file was already there, downloaded with the same
+	// parameters and unedited since, in which case nothing was downloaded. Only
+	// DownloadWithProvenance skips downloads, since it records the parameters.
+	Skipped bool
+
+	// Reports whether the content was served from the download cache.
+	Cached bool
+}
+
+// Downloads the content of a subtitle to a file. The content is written to a
+// temporary file in the same directory, synced and renamed over the path, so
+// the path never holds a partial file. A SHA-256 checksum of the content is
+// written next to the file, in the format of sha256sum, so later runs can tell
+// whether the file has changed since, unless it is to be skipped. An existing
+// file is reported as fs.ErrExist, unless it is to be overwritten.
+func (s *SubtitlesService) DownloadToPath(ctx context.Context, p *SubtitlesDownloadParameters, path string, o *DownloadToPathParameters) (*DownloadedFile, *Response, error) {
+	if o == nil {
+		o = &DownloadToPathParameters{}
+	}
+
+	mode := o.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	var mtime time.Time
+
+	st, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if !st.Mode().IsRegular() {
+			return nil, nil, &fs.PathError{Op: "download", Path: path, Err: errors.New("not a regular file")}
+		}
+		if !o.Overwrite {
+			return nil, nil, &fs.PathError{Op: "download", Path: path, Err: fs.ErrExist}
+		}
+		mode = st.Mode().Perm()
+		mtime = st.ModTime()
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return nil, nil, err
+	}
+	if !o.ModTime.IsZero() {
+		mtime = o.ModTime
+	}
+
+	var f *CachedFile
+	var res *Response
+	var commitErr *QuotaCommitError
+	write := createAtomic
+	if o.Overwrite {
+		write = writeAtomic
+	}
+	err = write(path, mode, func (w io.Writer) error {
+		var err error
+		f, res, err = s.DownloadFile(ctx, p, w)
+		if errors.As(err, &commitErr) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, res, err
+	}
+
+	if !mtime.IsZero() {
+		err = os.Chtimes(path, time.Time{}, mtime)
+		if err != nil {
+			return nil, res, err
+		}
+	}
+
+	if !o.SkipChecksum {
+		err = writeChecksumFile(path, f.SHA256)
+		if err != nil {
+			return nil, res, err
+		}
+	}
+
+	d := &DownloadedFile{
+		Path: path,
+		SHA256: f.SHA256,
+		Size: f.Size,
+		Cached: f.Cached,
+	}
+	if commitErr != nil {
+		return d, res, commitErr
+	}
+	return d, res, nil
+}
+
+// Reports whether the file still has the content recorded in its checksum file,
+// and returns its checksum. A file without a checksum file is reported as
+// changed.
+func FileUnchanged(path string) (string, bool, error) {
+	want, err := ReadChecksumFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	got, err := checksumFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return got, got == want, nil
+}
+
+// Returns the checksum recorded in the checksum file of the file.
+func ReadChecksumFile(path string) (string, error) {
+	data, err := os.ReadFile(path + checksumExtension)
+	if err != nil {
+		return "", err
+	}
+	sum := strings.SplitN(strings.TrimSpace(string(data)), " ", 2)[0]
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("rest: malformed checksum file %q", path + checksumExtension)
+	}
+	return strings.ToLower(sum), nil
+}
+
+func writeChecksumFile(path, sum string) error {
+	data := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	return writeFileAtomic(path + checksumExtension, []byte(data), 0644)
+}
+
+func checksumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Writes a file through a temporary file in the same directory, which is
+// synced and renamed over the name once fn has written all of the content.
+func writeAtomic(name string, perm fs.FileMode, fn func (w io.Writer) error) error {
+	return writeTemp(name, perm, fn, os.Rename)
+}
+
+// Links a file to a new name. It is replaced in the tests to act like a file
+// system without hard links.
+var link = os.Link
+
+// Writes a new file like writeAtomic does, but never replaces an existing one,
+// even one that is created while fn writes. The name is checked before fn
+// runs, so a download is not spent on it. The temporary file is then linked to
+// the name rather than renamed over it, since a link fails if the name exists.
+// File systems without hard links, such as FAT or many network shares, fail the
+// link for other reasons, in which case the name is claimed with an empty file
+// created exclusively and the temporary file is renamed over it.
+func createAtomic(name string, perm fs.FileMode, fn func (w io.Writer) error) error {
+	exists := &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+
+	_, err := os.Lstat(name)
+	if err == nil {
+		return exists
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return writeTemp(name, perm, fn, func (tmp, name string) error {
+		err := link(tmp, name)
+		if err == nil {
+			os.Remove(tmp)
+			return nil
+		}
+		if errors.Is(err, fs.ErrExist) {
+			return exists
+		}
+
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) {
+			return exists
+		}
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		err = os.Rename(tmp, name)
+		if err != nil {
+			os.Remove(name)
+		}
+		return err
+	})
+}
+
+// Writes the content with fn to a temporary file in the same directory, syncs
+// it and moves it to the name with commit. The temporary file is removed on
+// error.
+func writeTemp(name string, perm fs.FileMode, fn func (w io.Writer) error, commit func (tmp, name string) error) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	cErr := f.Close()
+	if err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = commit(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	syncDir(filepath.Dir(name))
+	return nil
+}
+
+// Syncs the directory, so a rename in it survives a crash. Not every platform
+// can sync a directory, so the errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	return writeAtomic(name, perm, func (w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDownload(content string) (*Client, *int, func ()) {
+	client, mux, teardown := setup()
+
+	n := 0
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%sfile"}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	})
+
+	return client, &n, teardown
+}
+
+func TestSubtitlesServiceDownloadToPath_WritesTheFileAndItsChecksum(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+	mt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	f, res, err := client.Subtitles.DownloadToPath(ctx, p, path, &DownloadToPathParameters{Mode: 0600, ModTime: mt})
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Equal(t, checksum([]byte("subtitle")), f.SHA256)
+	assert.Equal(t, int64(8), f.Size)
+	assert.False(t, f.Skipped)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", string(data))
+
+	st, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), st.Mode().Perm())
+	assert.True(t, mt.Equal(st.ModTime()))
+
+	data, err = os.ReadFile(path + ".sha256")
+	require.NoError(t, err)
+	assert.Equal(t, f.SHA256 + "  Movie.en.srt\n", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, _, err = client.Subtitles.DownloadToPath(ctx, p, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+	assert.Equal(t, 1, *n)
+
+	other := filepath.Join(t.TempDir(), "Movie.en.srt")
+	_, _, err = client.Subtitles.DownloadToPath(ctx, p, other, &DownloadToPathParameters{SkipChecksum: true})
+	require.NoError(t, err)
+	_, err = os.Stat(other + ".sha256")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSubtitlesServiceDownloadToPath_DoesNotTakeAnotherFileForTheSame(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+
+	_, _, err := client.Subtitles.DownloadToPath(ctx, &SubtitlesDownloadParameters{FileID: 1}, path, nil)
+	require.NoError(t, err)
+
+	f, _, err := client.Subtitles.DownloadToPath(ctx, &SubtitlesDownloadParameters{FileID: 2}, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+	assert.Nil(t, f)
+	assert.Equal(t, 1, *n)
+}
+
+func TestSubtitlesServiceDownloadToPath_KeepsAFileCreatedDuringTheDownload(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%sfile"}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		err := os.WriteFile(path, []byte("created"), 0644)
+		assert.NoError(t, err)
+		fmt.Fprint(w, "subtitle")
+	})
+
+	ctx := context.Background()
+	_, _, err := client.Subtitles.DownloadToPath(ctx, &SubtitlesDownloadParameters{FileID: 1}, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "created", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSubtitlesServiceDownloadToPath_RefusesToOverwrite(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	err := os.WriteFile(path, []byte("edited"), 0640)
+	require.NoError(t, err)
+	mt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(path, mt, mt)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+
+	_, _, err = client.Subtitles.DownloadToPath(ctx, p, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+	assert.Equal(t, 0, *n)
+
+	f, _, err := client.Subtitles.DownloadToPath(ctx, p, path, &DownloadToPathParameters{Overwrite: true})
+	require.NoError(t, err)
+	assert.False(t, f.Skipped)
+
+	st, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0640), st.Mode().Perm())
+	assert.True(t, mt.Equal(st.ModTime()))
+
+	sum, ok, err := FileUnchanged(path)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, f.SHA256, sum)
+
+	err = os.WriteFile(path, []byte("edited again"), 0640)
+	require.NoError(t, err)
+	_, ok, err = FileUnchanged(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSubtitlesServiceDownloadToPath_LeavesNothingBehindOnError(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Movie.en.srt")
+	_, _, err := client.Subtitles.DownloadToPath(context.Background(), &SubtitlesDownloadParameters{FileID: 1}, path, nil)
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReadChecksumFile_RejectsAMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.srt")
+	err := os.WriteFile(path + ".sha256", []byte("xyz  a.srt\n"), 0644)
+	require.NoError(t, err)
+
+	_, err = ReadChecksumFile(path)
+	assert.Error(t, err)
+}
+
+func TestSubtitlesServiceDownloadToPath_WorksWithoutHardLinks(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	link = func (oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	defer func () {
+		link = os.Link
+	}()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+
+	f, _, err := client.Subtitles.DownloadToPath(ctx, p, path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), f.Size)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, _, err = client.Subtitles.DownloadToPath(ctx, p, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+	assert.Equal(t, 1, *n)
+}
+
+func TestCreateAtomic_ChecksTheNameBeforeWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.srt")
+	err := os.WriteFile(path, []byte("existing"), 0644)
+	require.NoError(t, err)
+
+	err = createAtomic(path, 0644, func (w io.Writer) error {
+		t.Error("unexpected write")
+		return nil
+	})
+	assert.ErrorIs(t, err, fs.ErrExist)
+}
@@ -0,0 +1,10 @@
+package rest
+
+import (
+	"errors"
+)
+
+// Returned by the quota coordinator, the file token store and the download
+// cache on the platforms where a file cannot be locked against the other
+// processes, which would otherwise overwrite each other's changes.
+var ErrFileLockUnsupported = errors.New("rest: file locks are not supported on this platform")
@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package rest
+
+import (
+	"os"
+)
+
+// A lock that only guarded the goroutines of the process would let the other
+// processes corrupt the shared files, so locking fails instead.
+func lockFile(f *os.File) error {
+	return ErrFileLockUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return ErrFileLockUnsupported
+}
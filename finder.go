@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	FindMethodMoviehash = "moviehash"
+	FindMethodIMDBID    = "imdb_id"
+	FindMethodQuery     = "query"
+)
+
+// Returned by Find when none of the searches yields a subtitle that passes the
+// filters.
+var ErrNoSubtitles = errors.New("rest: no subtitles found")
+
+type FindParameters struct {
+	// The preferred languages, most preferred first.
+	Languages []string
+
+	// Searches by the IMDb ID instead of the query parsed from the file name
+	// when the moviehash search does not find anything.
+	IMDBID ID
+
+	// Each of the filters is one of "include", "exclude" or "only", and works
+	// the same way as the parameter of the same name in the search. An empty
+	// filter includes everything.
+	AITranslated      string
+	ForeignPartsOnly  string
+	HearingImpaired   string
+	MachineTranslated string
+
+	// Defaults to the weights that favor the release match.
+	Weights *RankWeights
+}
+
+type FindResult struct {
+	// The winning subtitle.
+	Candidate *RankedSubtitle
+
+	// All the subtitles that passed the filters, best first.
+	Candidates []*RankedSubtitle
+
+	// The search that found the candidate, one of the FindMethod constants.
+	Method    string
+	Moviehash string
+	Release   *Release
+
+	// Explains why the candidate won.
+	Reasons []string
+}
+
+// Finds the best subtitle for a video file. It searches by the moviehash of the
+// file first and falls back to the IMDb ID or to the query parsed from the file
+// name when the file is too small to hash or nothing matches, then ranks the
+// results and picks the best one in the most preferred language. The returned
+// response belongs to the last search made.
+func (s *SubtitlesService) Find(ctx context.Context, name string, p *FindParameters) (*FindResult, *Response, error) {
+	if p == nil {
+		p = &FindParameters{}
+	}
+
+	r := &FindResult{
+		Release: ParseRelease(name),
+	}
+
+	var res *Response
+
+	var sizeErr *VideoSizeError
+	h, err := MoviehashFile(name)
+	switch {
+	case errors.As(err, &sizeErr):
+	case err != nil:
+		return nil, nil, err
+	default:
+		r.Moviehash = h
+		sp := p.searchParameters()
+		sp.Moviehash = h
+		sp.MoviehashMatch = "only"
+		var d []*SubtitleEntity
+		d, res, err = s.Search(ctx, sp)
+		if err != nil {
+			return nil, res, err
+		}
+		if r.pick(d, name, p) {
+			r.Method = FindMethodMoviehash
+			r.Reasons = append([]string{"matched by the moviehash of the file"}, r.Reasons...)
+			return r, res, nil
+		}
+	}
+
+	sp := p.searchParameters()
+	switch {
+	case p.IMDBID != 0:
+		r.Method = FindMethodIMDBID
+		sp.IMDBID = p.IMDBID
+	case r.Release.Title != "":
+		r.Method = FindMethodQuery
+		sp.Query = r.Release.Title
+		sp.Year = r.Release.Year
+		sp.SeasonNumber = r.Release.Season
+		sp.EpisodeNumber = r.Release.Episode
+	default:
+		return nil, res, ErrNoSubtitles
+	}
+
+	d, res, err := s.Search(ctx, sp)
+	if err != nil {
+		return nil, res, err
+	}
+	if !r.pick(d, name, p) {
+		return nil, res, ErrNoSubtitles
+	}
+
+	var m string
+	if r.Method == FindMethodIMDBID {
+		m = fmt.Sprintf("found by the imdb id %d", p.IMDBID)
+	} else {
+		m = fmt.Sprintf("found by the query %q", sp.Query)
+	}
+	r.Reasons = append([]string{m}, r.Reasons...)
+
+	return r, res, nil
+}
+
+func (p *FindParameters) searchParameters() *SubtitlesSearchParameters {
+	return &SubtitlesSearchParameters{
+		AITranslated: p.AITranslated,
+		ForeignPartsOnly: p.ForeignPartsOnly,
+		HearingImpaired: p.HearingImpaired,
+		Languages: p.Languages,
+		MachineTranslated: p.MachineTranslated,
+	}
+}
+
+// Filters and ranks the subtitles and picks the best one in the most preferred
+// language. Reports whether there was anything to pick.
+func (r *FindResult) pick(d []*SubtitleEntity, name string, p *FindParameters) bool {
+	var f []*SubtitleEntity
+	for _, e := range d {
+		if e == nil || e.Attributes == nil || !p.accepts(e.Attributes) {
+			continue
+		}
+		f = append(f, e)
+	}
+
+	r.Candidates = RankSubtitles(f, &RankParameters{
+		FileName: name,
+		Weights: p.Weights,
+	})
+	if len(r.Candidates) == 0 {
+		return false
+	}
+
+	r.Candidate = r.Candidates[0]
+	r.Reasons = nil
+
+	for i, l := range p.Languages {
+		var c *RankedSubtitle
+		for _, rc := range r.Candidates {
+			a := rc.Entity.Attributes
+			if a.Language != nil && strings.EqualFold(*a.Language, l) {
+				c = rc
+				break
+			}
+		}
+		if c != nil {
+			r.Candidate = c
+			if len(p.Languages) > 1 {
+				r.Reasons = append(r.Reasons, fmt.Sprintf("in the preferred language %s (%d of %d)", l, i+1, len(p.Languages)))
+			}
+			break
+		}
+	}
+
+	r.Reasons = append(r.Reasons, r.Candidate.Reasons...)
+	if len(r.Candidates) > 1 {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("scored %.2f among %d candidates", r.Candidate.Score, len(r.Candidates)))
+	}
+
+	return true
+}
+
+func (p *FindParameters) accepts(a *Subtitle) bool {
+	return acceptsFilter(p.AITranslated, a.AITranslated) &&
+		acceptsFilter(p.ForeignPartsOnly, a.ForeignPartsOnly) &&
+		acceptsFilter(p.HearingImpaired, a.HearingImpaired) &&
+		acceptsFilter(p.MachineTranslated, a.MachineTranslated)
+}
+
+func acceptsFilter(f string, v *bool) bool {
+	b := v != nil && *v
+	switch f {
+	case "exclude":
+		return !b
+	case "only":
+		return b
+	default:
+		return true
+	}
+}
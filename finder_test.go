@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtitlesServiceFind_FindsByTheMoviehash(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	n := testVideo(t, "Movie.2019.1080p.BluRay.x264-GROUP.mkv")
+	h, err := MoviehashFile(n)
+	require.NoError(t, err)
+
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, h, r.URL.Query().Get("moviehash"))
+		assert.Equal(t, "only", r.URL.Query().Get("moviehash_match"))
+		assert.Equal(t, "de,en", r.URL.Query().Get("languages"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [
+			{"id": "1", "attributes": {"language": "en", "release": "Movie.2019.1080p.BluRay.x264-GROUP", "files": [{"file_id": 10}]}},
+			{"id": "2", "attributes": {"language": "de", "release": "Movie.2019.720p.WEBRip-OTHER", "files": [{"file_id": 20}]}},
+			{"id": "3", "attributes": {"language": "de", "release": "Movie.2019.1080p.BluRay.x264-GROUP", "hearing_impaired": true}}
+		]}`)
+	})
+
+	ctx := context.Background()
+	a, _, err := c.Subtitles.Find(ctx, n, &FindParameters{
+		Languages: []string{"de", "en"},
+		HearingImpaired: "exclude",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, FindMethodMoviehash, a.Method)
+	assert.Equal(t, h, a.Moviehash)
+	assert.Equal(t, ID(2), *a.Candidate.Entity.ID)
+	assert.Len(t, a.Candidates, 2)
+	assert.Equal(t, "matched by the moviehash of the file", a.Reasons[0])
+	assert.Equal(t, "in the preferred language de (1 of 2)", a.Reasons[1])
+}
+
+func TestSubtitlesServiceFind_FallsBackToTheQuery(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	n := testVideo(t, "Show.Name.S01E02.720p.HDTV-GRP.mkv")
+
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		if q.Get("moviehash") != "" {
+			fmt.Fprint(w, `{"data": []}`)
+			return
+		}
+		assert.Equal(t, "show name", q.Get("query"))
+		assert.Equal(t, "1", q.Get("season_number"))
+		assert.Equal(t, "2", q.Get("episode_number"))
+		fmt.Fprint(w, `{"data": [
+			{"id": "1", "attributes": {"language": "en", "release": "Show.Name.S01E02.720p.HDTV-GRP"}}
+		]}`)
+	})
+
+	ctx := context.Background()
+	a, _, err := c.Subtitles.Find(ctx, n, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, FindMethodQuery, a.Method)
+	assert.Equal(t, ID(1), *a.Candidate.Entity.ID)
+	assert.Equal(t, `found by the query "show name"`, a.Reasons[0])
+}
+
+func TestSubtitlesServiceFind_FallsBackToTheIMDBID(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.URL.Query().Get("moviehash"))
+		assert.Equal(t, "123", r.URL.Query().Get("imdb_id"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": []}`)
+	})
+
+	n := filepath.Join(t.TempDir(), "Sample.mkv")
+	err := os.WriteFile(n, []byte("short"), 0644)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, _, err = c.Subtitles.Find(ctx, n, &FindParameters{
+		IMDBID: 123,
+	})
+	assert.Equal(t, ErrNoSubtitles, err)
+}
+
+func TestSubtitlesServiceFind_ReturnsAnErrorIfTheFileCannotBeRead(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected search")
+	})
+
+	ctx := context.Background()
+	_, _, err := c.Subtitles.Find(ctx, filepath.Join(t.TempDir(), "Movie.2019.mkv"), &FindParameters{
+		IMDBID: 123,
+	})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func testVideo(t *testing.T, name string) string {
+	n := filepath.Join(t.TempDir(), name)
+	b := make([]byte, 2 * moviehashChunkSize)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	err := os.WriteFile(n, b, 0644)
+	require.NoError(t, err)
+	return n
+}
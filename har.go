@@ -0,0 +1,433 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const harVersion = "1.2"
+
+// An HTTP Archive, as described by the HAR 1.2 specification.
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time    `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct {}    `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+	Comment         string       `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// The timings of an entry in milliseconds. The send time is not measured, so
+// it is always zero.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Reads an HTTP Archive from a file.
+func OpenHAR(name string) (*HAR, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var h HAR
+	err = json.Unmarshal(data, &h)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot read the har %q: %w", name, err)
+	}
+	if h.Log == nil {
+		return nil, fmt.Errorf("rest: har %q has no log", name)
+	}
+	return &h, nil
+}
+
+// Writes the archive to a file.
+func (h *HAR) Save(name string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, data, 0600)
+}
+
+// Records the exchanges of a client into an HTTP Archive. The secrets are
+// redacted with RedactHeaders and RedactBody, so an archive can be attached to
+// a bug report. The recorder starts stopped.
+type HARRecorder struct {
+	mu        sync.Mutex
+	recording bool
+	entries   []*HAREntry
+}
+
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// Starts recording the exchanges.
+func (r *HARRecorder) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording = true
+}
+
+// Stops recording the exchanges. The entries recorded so far are kept.
+func (r *HARRecorder) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording = false
+}
+
+// Reports whether the recorder is recording.
+func (r *HARRecorder) Recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recording
+}
+
+// Drops the entries recorded so far.
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// Returns the archive of the entries recorded so far.
+func (r *HARRecorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := make([]*HAREntry, len(r.entries))
+	copy(e, r.entries)
+	return &HAR{
+		Log: &HARLog{
+			Version: harVersion,
+			Creator: &HARCreator{Name: "opensubtitlescli/rest", Version: Version},
+			Entries: e,
+		},
+	}
+}
+
+// Returns the middleware that records the exchanges of the client. Add it with
+// Client.Use, and with Client.UseForLinks to record the download links that
+// DownloadFile fetches as well, so the downloads can be replayed.
+func (r *HARRecorder) Middleware() Middleware {
+	return func (next RequestHandler) RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*Response, error) {
+			if !r.Recording() {
+				return next(ctx, req)
+			}
+
+			e := &HAREntry{
+				StartedDateTime: time.Now().UTC(),
+				Request: newHARRequest(req),
+				Timings: &HARTimings{},
+			}
+
+			start := time.Now()
+			res, err := next(ctx, req)
+			e.Timings.Wait = milliseconds(time.Since(start))
+
+			if res != nil && res.Response != nil {
+				start = time.Now()
+				e.Response = newHARResponse(res)
+				e.Timings.Receive = milliseconds(time.Since(start))
+			} else {
+				e.Response = &HARResponse{
+					Cookies: []*HARNameValue{},
+					Headers: []*HARNameValue{},
+					Content: &HARContent{},
+				}
+			}
+			if err != nil {
+				e.Comment = err.Error()
+			}
+			e.Time = e.Timings.Send + e.Timings.Wait + e.Timings.Receive
+
+			r.mu.Lock()
+			r.entries = append(r.entries, e)
+			r.mu.Unlock()
+
+			return res, err
+		}
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newHARRequest(req *http.Request) *HARRequest {
+	r := &HARRequest{
+		Method: req.Method,
+		URL: req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies: []*HARNameValue{},
+		Headers: harHeaders(req.Header),
+		QueryString: []*HARNameValue{},
+		HeadersSize: -1,
+		BodySize: 0,
+	}
+	if r.HTTPVersion == "" {
+		r.HTTPVersion = "HTTP/1.1"
+	}
+
+	q := req.URL.Query()
+	for _, k := range sortedKeys(q) {
+		for _, v := range q[k] {
+			r.QueryString = append(r.QueryString, &HARNameValue{Name: k, Value: v})
+		}
+	}
+
+	if req.Body != nil && req.GetBody != nil {
+		b, err := req.GetBody()
+		if err == nil {
+			data, err := io.ReadAll(b)
+			b.Close()
+			if err == nil && len(data) > 0 {
+				r.BodySize = len(data)
+				r.PostData = &HARPostData{
+					MimeType: req.Header.Get("Content-Type"),
+					Text: RedactBody(data, req.Header, len(data)),
+				}
+			}
+		}
+	}
+
+	return r
+}
+
+// Describes the response and replaces its body with a copy, so it can still be
+// read after the recording.
+func newHARResponse(res *Response) *HARResponse {
+	r := &HARResponse{
+		Status: res.StatusCode,
+		StatusText: strings.TrimSpace(strings.TrimPrefix(res.Status, fmt.Sprint(res.StatusCode))),
+		HTTPVersion: res.Proto,
+		Cookies: []*HARNameValue{},
+		Headers: harHeaders(res.Header),
+		Content: &HARContent{MimeType: res.Header.Get("Content-Type")},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize: -1,
+	}
+	if r.HTTPVersion == "" {
+		r.HTTPVersion = "HTTP/1.1"
+	}
+
+	if res.Body == nil {
+		return r
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		// The body of a failed response that is not JSON is closed before the
+		// middleware sees it.
+		return r
+	}
+
+	r.BodySize = len(data)
+	r.Content.Size = len(data)
+	switch {
+	case len(data) == 0:
+	case IsTextBody(res.Header):
+		r.Content.Text = RedactBody(data, res.Header, len(data))
+	case utf8.Valid(data):
+		r.Content.Text = string(data)
+	default:
+		r.Content.Text = base64.StdEncoding.EncodeToString(data)
+		r.Content.Encoding = "base64"
+	}
+	return r
+}
+
+func harHeaders(h http.Header) []*HARNameValue {
+	h = RedactHeaders(h)
+	r := []*HARNameValue{}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			r = append(r, &HARNameValue{Name: k, Value: v})
+		}
+	}
+	return r
+}
+
+func sortedKeys(m map[string][]string) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// A transport that serves the responses of an HTTP Archive instead of sending
+// the requests, for deterministic offline tests. A request matches an entry
+// with the same method, path and query, regardless of the host. The entries
+// that match a request are served in the order they were recorded, and the
+// last one is served again once they run out.
+type HARTransport struct {
+	mu      sync.Mutex
+	entries []*HAREntry
+	served  map[string]int
+}
+
+func NewHARTransport(h *HAR) *HARTransport {
+	t := &HARTransport{served: map[string]int{}}
+	if h != nil && h.Log != nil {
+		t.entries = h.Log.Entries
+	}
+	return t
+}
+
+func (t *HARTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	k := harKey(req.Method, req.URL.Path, req.URL.Query().Encode())
+
+	t.mu.Lock()
+	var m []*HAREntry
+	for _, e := range t.entries {
+		if e.Request == nil || e.Response == nil {
+			continue
+		}
+		u, err := req.URL.Parse(e.Request.URL)
+		if err != nil {
+			continue
+		}
+		if harKey(e.Request.Method, u.Path, u.Query().Encode()) == k {
+			m = append(m, e)
+		}
+	}
+	i := t.served[k]
+	if i < len(m) {
+		t.served[k] = i + 1
+	}
+	t.mu.Unlock()
+
+	if len(m) == 0 {
+		return nil, fmt.Errorf("rest: har has no response for %s %s", req.Method, req.URL)
+	}
+	if i >= len(m) {
+		i = len(m) - 1
+	}
+	return newHARHTTPResponse(req, m[i].Response)
+}
+
+func harKey(method, path, query string) string {
+	return strings.ToUpper(method) + " " + path + "?" + query
+}
+
+func newHARHTTPResponse(req *http.Request, r *HARResponse) (*http.Response, error) {
+	var data []byte
+	if r.Content != nil {
+		if r.Content.Encoding == "base64" {
+			var err error
+			data, err = base64.StdEncoding.DecodeString(r.Content.Text)
+			if err != nil {
+				return nil, fmt.Errorf("rest: cannot decode the har content: %w", err)
+			}
+		} else {
+			data = []byte(r.Content.Text)
+		}
+	}
+
+	h := http.Header{}
+	for _, v := range r.Headers {
+		h.Add(v.Name, v.Value)
+	}
+	// The recorded length may not match the redacted content.
+	h.Del("Content-Length")
+
+	proto := r.HTTPVersion
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		major, minor = 1, 1
+	}
+
+	return &http.Response{
+		Status: strings.TrimSpace(fmt.Sprintf("%d %s", r.Status, r.StatusText)),
+		StatusCode: r.Status,
+		Proto: proto,
+		ProtoMajor: major,
+		ProtoMinor: minor,
+		Header: h,
+		Body: io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request: req,
+	}, nil
+}
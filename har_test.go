@@ -0,0 +1,206 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHARRecorder_RecordsTheExchangesWhileStarted(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1"}]}`)
+	})
+
+	r := NewHARRecorder()
+	c.Use(r.Middleware())
+
+	ctx := context.Background()
+	p := &FeaturesSearchParameters{Query: "hi"}
+
+	_, _, err := c.Features.Search(ctx, p)
+	require.NoError(t, err)
+	assert.Len(t, r.HAR().Log.Entries, 0)
+
+	r.Start()
+	assert.True(t, r.Recording())
+	a, _, err := c.Features.Search(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, []*FeatureEntity{{ID: AllocateID(1)}}, a)
+
+	r.Stop()
+	_, _, err = c.Features.Search(ctx, p)
+	require.NoError(t, err)
+
+	h := r.HAR()
+	assert.Equal(t, "1.2", h.Log.Version)
+	require.Len(t, h.Log.Entries, 1)
+
+	e := h.Log.Entries[0]
+	assert.Equal(t, "GET", e.Request.Method)
+	assert.True(t, strings.HasSuffix(e.Request.URL, "/features?&query=hi"))
+	assert.Equal(t, []*HARNameValue{{Name: "query", Value: "hi"}}, e.Request.QueryString)
+	assert.Equal(t, 200, e.Response.Status)
+	assert.Equal(t, "OK", e.Response.StatusText)
+	assert.Equal(t, `{"data":[{"id":"1"}]}`, e.Response.Content.Text)
+	assert.Equal(t, e.Timings.Wait + e.Timings.Receive, e.Time)
+
+	r.Reset()
+	assert.Len(t, r.HAR().Log.Entries, 0)
+}
+
+func TestHARRecorder_RedactsTheSecrets(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/login", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"token": "secret-token", "status": 200}`)
+	})
+
+	c.APIKey = "secret-key"
+	r := NewHARRecorder()
+	r.Start()
+	c.Use(r.Middleware())
+
+	_, _, err := c.Auth.Login(context.Background(), &Credentials{Username: "u", Password: "secret-password"})
+	require.NoError(t, err)
+
+	n := filepath.Join(t.TempDir(), "session.har")
+	err = r.HAR().Save(n)
+	require.NoError(t, err)
+
+	h, err := OpenHAR(n)
+	require.NoError(t, err)
+	require.Len(t, h.Log.Entries, 1)
+
+	e := h.Log.Entries[0]
+	assert.Equal(t, `{"password":"[REDACTED]","username":"u"}`, e.Request.PostData.Text)
+	assert.Equal(t, `{"status":200,"token":"[REDACTED]"}`, e.Response.Content.Text)
+	assert.Contains(t, e.Request.Headers, &HARNameValue{Name: apiKeyHeader, Value: redacted})
+
+	for _, s := range []string{"secret-key", "secret-password", "secret-token"} {
+		assert.NotContains(t, fmt.Sprint(e.Request, e.Response), s)
+	}
+}
+
+func TestHARRecorder_RecordsTheFailedExchanges(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+	})
+
+	r := NewHARRecorder()
+	r.Start()
+	c.Use(r.Middleware())
+
+	_, _, err := c.Features.Search(context.Background(), &FeaturesSearchParameters{})
+	var re *RateLimitError
+	assert.True(t, AsError(err, &re))
+
+	e := r.HAR().Log.Entries[0]
+	assert.Equal(t, 429, e.Response.Status)
+	assert.Contains(t, e.Response.Content.Text, "Throttle limit reached")
+	assert.Equal(t, err.Error(), e.Comment)
+}
+
+func TestHARTransport_ReplaysTheRecordedResponses(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	calls := 0
+	m.HandleFunc("/features", func (w http.ResponseWriter, r *http.Request) {
+		calls += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"id": "%d"}]}`, calls)
+	})
+	m.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte{0xff, 0x00, 0xfe})
+	})
+
+	r := NewHARRecorder()
+	r.Start()
+	c.Use(r.Middleware())
+
+	ctx := context.Background()
+	p := &FeaturesSearchParameters{Query: "hi", Type: "movie"}
+	for i := 0; i < 2; i += 1 {
+		_, _, err := c.Features.Search(ctx, p)
+		require.NoError(t, err)
+	}
+	req, err := c.NewRequest("GET", c.BaseURL.String() + "download", nil)
+	require.NoError(t, err)
+	_, err = c.Do(ctx, req, &strings.Builder{})
+	require.NoError(t, err)
+
+	h := r.HAR()
+	assert.Equal(t, "base64", h.Log.Entries[2].Response.Content.Encoding)
+
+	rc := NewClient(&http.Client{Transport: NewHARTransport(h)})
+	rc.BaseURL, _ = url.Parse("https://offline.invalid/")
+
+	for _, id := range []int64{1, 2, 2} {
+		a, res, err := rc.Features.Search(ctx, &FeaturesSearchParameters{Type: "movie", Query: "hi"})
+		require.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, []*FeatureEntity{{ID: AllocateID(id)}}, a)
+	}
+
+	var b strings.Builder
+	_, err = rc.Subtitles.fetch(ctx, "https://offline.invalid/download", &b)
+	require.NoError(t, err)
+	assert.Equal(t, string([]byte{0xff, 0x00, 0xfe}), b.String())
+
+	_, _, err = rc.Features.Search(ctx, &FeaturesSearchParameters{Query: "other"})
+	assert.EqualError(t, err, `Get "https://offline.invalid/features?&query=other": rest: har has no response for GET https://offline.invalid/features?&query=other`)
+}
+
+func TestHARTransport_ReplaysADownload(t *testing.T) {
+	c, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	r := NewHARRecorder()
+	r.Start()
+	c.Use(r.Middleware())
+	c.UseForLinks(r.Middleware())
+
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+	var b strings.Builder
+	_, _, err := c.Subtitles.DownloadFile(ctx, p, &b)
+	require.NoError(t, err)
+
+	name := filepath.Join(t.TempDir(), "download.har")
+	err = r.HAR().Save(name)
+	require.NoError(t, err)
+	h, err := OpenHAR(name)
+	require.NoError(t, err)
+	require.Len(t, h.Log.Entries, 2)
+	assert.Equal(t, "POST", h.Log.Entries[0].Request.Method)
+	assert.Equal(t, "GET", h.Log.Entries[1].Request.Method)
+
+	rc := NewClient(&http.Client{Transport: NewHARTransport(h)})
+	rc.BaseURL = c.BaseURL
+
+	b.Reset()
+	f, _, err := rc.Subtitles.DownloadFile(ctx, p, &b)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", b.String())
+	assert.Equal(t, "a.srt", f.FileName)
+	assert.Equal(t, 1, *n)
+}
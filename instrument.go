@@ -0,0 +1,193 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// The names of the metrics reported to the instrumentation.
+const (
+	// Counts the requests sent by BareDo, including the failed ones, but not
+	// the ones that shared the response of an identical request in flight.
+	MetricRequests = "rest.requests"
+
+	// Counts the successful download requests, which spend the quota.
+	MetricDownloads = "rest.downloads"
+
+	// Counts the downloads served from the download cache.
+	MetricCacheHits = "rest.cache_hits"
+
+	// The remaining requests of the rate limit, as of the last response.
+	MetricRateRemaining = "rest.rate.remaining"
+
+	// The remaining downloads of the quota, as of the last response that
+	// reported it.
+	MetricQuotaRemaining = "rest.quota.remaining"
+)
+
+// Receives the spans and metrics of a client. It has no dependencies, so a
+// service can bridge it to the tracing and metrics of its choice, such as
+// OpenTelemetry. The methods may be called concurrently.
+type Instrumentation interface {
+	// Starts a span for a request sent by BareDo, including one that the
+	// coalescer answers with the response of an identical request in flight.
+	// The returned context is passed down to the request.
+	StartSpan(ctx context.Context, s *SpanStart) (context.Context, Span)
+
+	// Adds the value to the counter.
+	Count(ctx context.Context, name string, n int64)
+
+	// Records the current value of the gauge.
+	Gauge(ctx context.Context, name string, v int64)
+}
+
+type SpanStart struct {
+	// The name of the endpoint relative to the base URL, such as "subtitles"
+	// or "infos/user", or "link" for a request to another host, such as the
+	// download of a file.
+	Endpoint string
+	Method   string
+	URL      string
+}
+
+type Span interface {
+	// Ends the span with the outcome of the request.
+	End(e *SpanEnd)
+}
+
+type SpanEnd struct {
+	// The status code of the response, or zero if there is none.
+	Status int
+
+	// The class of the error, such as "RateLimitError" or "QuotaError", or an
+	// empty string if there is no error.
+	ErrorClass string
+	Error      error
+
+	// Reports whether the response was shared from an identical request in
+	// flight, so no round-trip was made for this one.
+	Coalesced bool
+}
+
+// Returns the class of an error as reported in the spans: the name of the
+// typed error of the package, "ContextError" for a canceled or expired
+// context, or "Error" for anything else. The errors that CheckResponse adds
+// for the headers that the request did not have are not classified.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		userAgent   *UserAgentError
+		apiKey      *APIKeyError
+		authToken   *AuthTokenError
+		credentials *CredentialsError
+		file        *FileError
+		quota       *QuotaError
+		link        *LinkError
+		rateLimit   *RateLimitError
+		reserve     *ReserveError
+		circuit     *CircuitOpenError
+		response    *ErrorResponse
+	)
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return "ContextError"
+	case errors.Is(err, ErrNoAPIKeys):
+		return "NoAPIKeysError"
+	case errors.As(err, &circuit):
+		return "CircuitOpenError"
+	case AsError(err, &rateLimit):
+		return "RateLimitError"
+	case AsError(err, &quota):
+		return "QuotaError"
+	case AsError(err, &reserve):
+		return "ReserveError"
+	case AsReportedError(err, &apiKey):
+		return "APIKeyError"
+	case AsReportedError(err, &authToken):
+		return "AuthTokenError"
+	case AsError(err, &credentials):
+		return "CredentialsError"
+	case AsReportedError(err, &userAgent):
+		return "UserAgentError"
+	case AsError(err, &file):
+		return "FileError"
+	case AsError(err, &link):
+		return "LinkError"
+	case AsError(err, &response):
+		return "ErrorResponse"
+	default:
+		return "Error"
+	}
+}
+
+// Sends the request through the handler within a span, and reports the
+// request counter and the rate and quota gauges.
+func (c *Client) instrumented(ctx context.Context, req *http.Request, h RequestHandler) (*Response, error) {
+	return c.instrument(ctx, req, func (ctx context.Context, req *http.Request) (*Response, bool, error) {
+		res, err := h(ctx, req)
+		return res, false, err
+	})
+}
+
+// Sends the request like instrumented does, but fn also reports whether the
+// response was shared from an identical request in flight, which is not
+// counted as a request.
+func (c *Client) instrument(ctx context.Context, req *http.Request, fn func (ctx context.Context, req *http.Request) (*Response, bool, error)) (*Response, error) {
+	in := c.Instrumentation
+	if in == nil {
+		res, _, err := fn(ctx, req)
+		return res, err
+	}
+
+	ctx, span := in.StartSpan(ctx, &SpanStart{
+		Endpoint: c.endpoint(req),
+		Method: req.Method,
+		URL: req.URL.String(),
+	})
+	req = req.WithContext(ctx)
+
+	res, shared, err := fn(ctx, req)
+
+	e := &SpanEnd{
+		ErrorClass: ErrorClass(err),
+		Error: err,
+		Coalesced: shared,
+	}
+	if !shared {
+		in.Count(ctx, MetricRequests, 1)
+	}
+	if res != nil && res.Response != nil {
+		e.Status = res.StatusCode
+		if res.Rate.Limit > 0 {
+			in.Gauge(ctx, MetricRateRemaining, int64(res.Rate.Remaining))
+		}
+		if !res.Quota.ResetTimeUTC.IsZero() {
+			in.Gauge(ctx, MetricQuotaRemaining, int64(res.Quota.Remaining))
+		}
+	}
+	span.End(e)
+
+	return res, err
+}
+
+// Returns the name of the endpoint of the request, without the base URL and
+// the query.
+func (c *Client) endpoint(req *http.Request) string {
+	b := c.BaseURL
+	if b == nil || req.URL.Host != b.Host {
+		return "link"
+	}
+	p := strings.TrimPrefix(req.URL.Path, b.Path)
+	return strings.Trim(p, "/")
+}
+
+func (c *Client) count(ctx context.Context, name string) {
+	if c.Instrumentation != nil {
+		c.Instrumentation.Count(ctx, name, 1)
+	}
+}
@@ -0,0 +1,175 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testInstrumentation struct {
+	mu       sync.Mutex
+	starts   []*SpanStart
+	ends     []*SpanEnd
+	counters map[string]int64
+	gauges   map[string]int64
+}
+
+type testSpan struct {
+	in *testInstrumentation
+}
+
+func newTestInstrumentation() *testInstrumentation {
+	return &testInstrumentation{
+		counters: map[string]int64{},
+		gauges: map[string]int64{},
+	}
+}
+
+func (in *testInstrumentation) StartSpan(ctx context.Context, s *SpanStart) (context.Context, Span) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.starts = append(in.starts, s)
+	return ctx, &testSpan{in: in}
+}
+
+func (in *testInstrumentation) Count(ctx context.Context, name string, n int64) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.counters[name] += n
+}
+
+func (in *testInstrumentation) Gauge(ctx context.Context, name string, v int64) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.gauges[name] = v
+}
+
+func (s *testSpan) End(e *SpanEnd) {
+	s.in.mu.Lock()
+	defer s.in.mu.Unlock()
+	s.in.ends = append(s.in.ends, e)
+}
+
+func TestInstrumentation_ReportsTheSpansAndMetrics(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerRateLimit, "5")
+		w.Header().Set(headerRateRemaining, "4")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{
+			"link": "%sfile",
+			"remaining": 7,
+			"reset_time_utc": "2023-01-01T00:00:00.000Z"
+		}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "subtitle")
+	})
+
+	c, err := OpenDownloadCache(t.TempDir(), 0)
+	require.NoError(t, err)
+	client.DownloadCache = c
+
+	in := newTestInstrumentation()
+	client.Instrumentation = in
+	client = client.WithAuthToken("xxx")
+
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+	for i := 0; i < 2; i += 1 {
+		_, _, err = client.Subtitles.DownloadFile(ctx, p, &bytes.Buffer{})
+		require.NoError(t, err)
+	}
+
+	require.Len(t, in.starts, 2)
+	assert.Equal(t, "download", in.starts[0].Endpoint)
+	assert.Equal(t, "POST", in.starts[0].Method)
+	assert.Equal(t, "file", in.starts[1].Endpoint)
+	assert.Equal(t, []*SpanEnd{{Status: 200}, {Status: 200}}, in.ends)
+	assert.Equal(t, map[string]int64{
+		MetricRequests: 2,
+		MetricDownloads: 1,
+		MetricCacheHits: 1,
+	}, in.counters)
+	assert.Equal(t, map[string]int64{
+		MetricRateRemaining: 4,
+		MetricQuotaRemaining: 7,
+	}, in.gauges)
+}
+
+func TestInstrumentation_ReportsTheErrorClass(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+	})
+
+	in := newTestInstrumentation()
+	client.Instrumentation = in
+
+	_, _, err := client.Users.Get(context.Background())
+	require.Error(t, err)
+
+	require.Len(t, in.ends, 1)
+	assert.Equal(t, "infos/user", in.starts[0].Endpoint)
+	assert.Equal(t, 429, in.ends[0].Status)
+	assert.Equal(t, "RateLimitError", in.ends[0].ErrorClass)
+	assert.Equal(t, err, in.ends[0].Error)
+}
+
+func TestInstrumentation_IsCopiedWithTheClient(t *testing.T) {
+	client := NewClient(nil)
+	in := newTestInstrumentation()
+	client.Instrumentation = in
+	assert.Equal(t, in, client.WithAuthToken("xxx").Instrumentation)
+}
+
+func TestErrorClass_ClassifiesTheErrors(t *testing.T) {
+	q := &QuotaError{}
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{errors.New("hi"), "Error"},
+		{fmt.Errorf("wrapped: %w", context.Canceled), "ContextError"},
+		{ErrNoAPIKeys, "NoAPIKeysError"},
+		{&ReserveError{}, "ReserveError"},
+		{&ErrorResponse{Errors: []error{&APIKeyError{}, q}}, "QuotaError"},
+		{&ErrorResponse{Errors: []error{&ResponseError{}}}, "ErrorResponse"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, ErrorClass(tt.err))
+	}
+}
+
+func TestErrorClass_IgnoresTheErrorsAddedByTheClient(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"message": "Internal server error"}`)
+	})
+
+	_, _, err := c.Subtitles.Search(context.Background(), &SubtitlesSearchParameters{Query: "hi"})
+	var e *AuthTokenError
+	require.True(t, AsError(err, &e))
+	assert.Equal(t, "ErrorResponse", ErrorClass(err))
+
+	assert.Equal(t, "AuthTokenError", ErrorClass(&ErrorResponse{Errors: []error{&AuthTokenError{Message: "Invalid token"}}}))
+	assert.Equal(t, "Error", ErrorClass(&AuthTokenError{Message: "rest: authorization header is empty"}))
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type APIKeyStrategy int
+
+const (
+	// Uses the keys in turn.
+	RoundRobin APIKeyStrategy = iota
+
+	// Uses the key that was throttled the longest time ago, or never.
+	LeastRecentlyThrottled
+)
+
+const defaultAPIKeyCooldown = time.Second
+
+// Returned when every key of the pool has been taken out of rotation.
+var ErrNoAPIKeys = errors.New("rest: all api keys of the pool are disabled")
+
+// A pool of API keys that the client rotates between. A key that is throttled
+// rests until the rate limit resets, and a key that the server refuses is
+// taken out of rotation.
+type APIKeyPool struct {
+	mu       sync.Mutex
+	keys     []*apiKeyState
+	strategy APIKeyStrategy
+	next     int
+}
+
+type apiKeyState struct {
+	APIKeyHealth
+	resting time.Time
+}
+
+type APIKeyHealth struct {
+	Key           string
+	Requests      int
+	Throttled     int
+	LastThrottled time.Time
+
+	// Reports whether the key has been taken out of rotation, and why.
+	Disabled bool
+	Reason   string
+}
+
+func NewAPIKeyPool(keys []string, s APIKeyStrategy) *APIKeyPool {
+	p := &APIKeyPool{strategy: s}
+	for _, k := range keys {
+		p.keys = append(p.keys, &apiKeyState{
+			APIKeyHealth: APIKeyHealth{Key: k},
+		})
+	}
+	return p
+}
+
+// Returns the health of every key of the pool.
+func (p *APIKeyPool) Health() []APIKeyHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := make([]APIKeyHealth, len(p.keys))
+	for i, k := range p.keys {
+		r[i] = k.APIKeyHealth
+	}
+	return r
+}
+
+// Returns the number of keys that are still in rotation.
+func (p *APIKeyPool) Active() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, k := range p.keys {
+		if !k.Disabled {
+			n += 1
+		}
+	}
+	return n
+}
+
+// Picks the key for the next request. Keys that rest are only picked if there
+// is nothing else.
+func (p *APIKeyPool) pick(now time.Time) (*apiKeyState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best, bestResting := -1, false
+
+	n := len(p.keys)
+	for i := 0; i < n; i += 1 {
+		j := (p.next + i) % n
+		k := p.keys[j]
+		if k.Disabled {
+			continue
+		}
+		resting := now.Before(k.resting)
+
+		switch {
+		case best == -1 || (bestResting && !resting):
+			best, bestResting = j, resting
+		case p.strategy == LeastRecentlyThrottled && resting == bestResting &&
+			k.LastThrottled.Before(p.keys[best].LastThrottled):
+			best = j
+		}
+
+		if p.strategy == RoundRobin && !bestResting {
+			break
+		}
+	}
+
+	if best == -1 {
+		return nil, ErrNoAPIKeys
+	}
+
+	p.next = best + 1
+	k := p.keys[best]
+	k.Requests += 1
+	return k, nil
+}
+
+// Updates the health of the key with the outcome of a request and reports
+// whether the request can be retried with another key.
+func (p *APIKeyPool) report(k *apiKeyState, res *Response, err error, now time.Time) bool {
+	var ke *APIKeyError
+	if AsError(err, &ke) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		k.Disabled = true
+		k.Reason = ke.Message
+		return true
+	}
+
+	if isRateLimitError(err) {
+		d := defaultAPIKeyCooldown
+		if res != nil && res.Rate.Reset > 0 {
+			d = time.Duration(res.Rate.Reset) * time.Second
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		k.Throttled += 1
+		k.LastThrottled = now
+		k.resting = now.Add(d)
+		return true
+	}
+
+	if err == nil && res != nil && res.Rate.Limit > 0 && res.Rate.Remaining <= 0 {
+		// The key is not throttled yet, but the next request with it will be.
+		d := time.Duration(res.Rate.Reset) * time.Second
+		if d <= 0 {
+			d = defaultAPIKeyCooldown
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		k.resting = now.Add(d)
+	}
+
+	return false
+}
+
+// Sends the request with the keys of the pool, moving on to the next key while
+// the server throttles or refuses the current one.
+func (c *Client) doWithKeyPool(ctx context.Context, req *http.Request, dt *decodeTarget) (*Response, error) {
+	n := c.APIKeyPool.Active()
+	for i := 0; ; i += 1 {
+		k, err := c.APIKeyPool.pick(time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		r := req.Clone(ctx)
+		r.Header.Set(apiKeyHeader, k.Key)
+		if i > 0 && req.Body != nil {
+			r.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := c.bareDo(ctx, r, dt)
+		retry := c.APIKeyPool.report(k, res, err, time.Now())
+		if !retry || i+1 >= n || (req.Body != nil && req.GetBody == nil) {
+			return res, err
+		}
+	}
+}
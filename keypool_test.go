@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyPoolPick_RotatesTheKeys(t *testing.T) {
+	now := time.Now()
+
+	p := NewAPIKeyPool([]string{"a", "b", "c"}, RoundRobin)
+	var a []string
+	for i := 0; i < 4; i += 1 {
+		k, err := p.pick(now)
+		require.NoError(t, err)
+		a = append(a, k.Key)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, a)
+
+	p.keys[1].resting = now.Add(time.Minute)
+	p.keys[2].Disabled = true
+	a = nil
+	for i := 0; i < 2; i += 1 {
+		k, err := p.pick(now)
+		require.NoError(t, err)
+		a = append(a, k.Key)
+	}
+	assert.Equal(t, []string{"a", "a"}, a)
+
+	p.keys[0].Disabled = true
+	k, err := p.pick(now)
+	require.NoError(t, err)
+	assert.Equal(t, "b", k.Key)
+
+	p.keys[1].Disabled = true
+	_, err = p.pick(now)
+	assert.Equal(t, ErrNoAPIKeys, err)
+}
+
+func TestAPIKeyPoolPick_PrefersTheLeastRecentlyThrottled(t *testing.T) {
+	now := time.Now()
+
+	p := NewAPIKeyPool([]string{"a", "b", "c"}, LeastRecentlyThrottled)
+	p.keys[0].LastThrottled = now.Add(-time.Minute)
+	p.keys[1].LastThrottled = now.Add(-time.Hour)
+	p.keys[2].LastThrottled = now.Add(-2 * time.Hour)
+	p.keys[2].resting = now.Add(time.Minute)
+
+	k, err := p.pick(now)
+	require.NoError(t, err)
+	assert.Equal(t, "b", k.Key)
+}
+
+func TestBareDo_RotatesTheKeysOfThePool(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	var keys []string
+	m.HandleFunc("/hi", func (w http.ResponseWriter, r *http.Request) {
+		k := r.Header.Get(apiKeyHeader)
+		keys = append(keys, k)
+		w.Header().Set("Content-Type", "application/json")
+		switch k {
+		case "revoked":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You cannot consume this service"}`)
+		case "throttled":
+			w.Header().Set(headerRateReset, "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	})
+
+	c.APIKeyPool = NewAPIKeyPool([]string{"revoked", "throttled", "good"}, RoundRobin)
+
+	u, err := c.NewURL("hi", nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i += 1 {
+		req, err := c.NewRequest("POST", u, map[string]int{"a": 1})
+		require.NoError(t, err)
+		_, err = c.Do(ctx, req, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"revoked", "throttled", "good", "good"}, keys)
+
+	h := c.APIKeyPool.Health()
+	assert.True(t, h[0].Disabled)
+	assert.Equal(t, "You cannot consume this service", h[0].Reason)
+	assert.Equal(t, 1, h[1].Throttled)
+	assert.Equal(t, 2, h[2].Requests)
+}
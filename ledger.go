@@ -0,0 +1,304 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The period after which the download quota is reset.
+const quotaPeriod = 24 * time.Hour
+
+// A record of a single download call.
+type LedgerEntry struct {
+	Time         time.Time `json:"time"`
+	FileID       ID        `json:"file_id"`
+	SubtitleID   ID        `json:"subtitle_id,omitempty"`
+	Remaining    int       `json:"remaining"`
+	Requests     int       `json:"requests"`
+	ResetTimeUTC time.Time `json:"reset_time_utc"`
+	Tool         string    `json:"tool,omitempty"`
+	User         string    `json:"user,omitempty"`
+
+	// Reports whether the download was served without a call, so it did not
+	// spend the quota.
+	Cached bool `json:"cached,omitempty"`
+
+	// Reports whether the call was refused because the quota was exhausted.
+	Refused bool `json:"refused,omitempty"`
+}
+
+// An append-only local ledger of downloads, stored as JSON lines. A ledger set
+// as the DownloadLedger of a client records every download of the client.
+type DownloadLedger struct {
+	mu   sync.Mutex
+	name string
+
+	// The name of the tool and the user the downloads are recorded for.
+	Tool string
+	User string
+
+	// The number of downloads to keep in reserve. Downloads that would leave
+	// fewer of them are refused with a ReserveError.
+	Reserve int
+}
+
+// Returned when a download would leave less of the quota than the reserve.
+type ReserveError struct {
+	Remaining int
+	Reserve   int
+}
+
+func (e *ReserveError) Error() string {
+	return fmt.Sprintf("rest: download would exceed the quota reserve of %d, %d remaining", e.Reserve, e.Remaining)
+}
+
+// Creates a ledger stored in the file. The file is created on the first record.
+func NewDownloadLedger(name string) *DownloadLedger {
+	return &DownloadLedger{name: name}
+}
+
+// Appends an entry to the ledger. The tool and the user of the ledger are used
+// if the entry does not have its own.
+func (l *DownloadLedger) Record(e *LedgerEntry) error {
+	c := *e
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+	if c.Tool == "" {
+		c.Tool = l.Tool
+	}
+	if c.User == "" {
+		c.User = l.User
+	}
+
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Appends of a single line are atomic on local file systems, so several
+	// processes can share the ledger.
+	f, err := os.OpenFile(l.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	cErr := f.Close()
+	if err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// Reads all the entries of the ledger, oldest first.
+func (l *DownloadLedger) Entries() ([]*LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r []*LedgerEntry
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n += 1 {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		err = json.Unmarshal(s.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf("rest: cannot read line %d of the ledger %q: %w", n, l.name, err)
+		}
+		r = append(r, &e)
+	}
+	err = s.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(r, func (i, j int) bool {
+		return r[i].Time.Before(r[j].Time)
+	})
+
+	return r, nil
+}
+
+type LedgerSpending struct {
+	Tool      string
+	User      string
+	Downloads int
+}
+
+type QuotaForecast struct {
+	// The number of downloads left until the reset.
+	Remaining int
+
+	// The number of downloads allowed per period.
+	Allowed int
+
+	ResetTimeUTC time.Time
+
+	// Reports whether the quota has been reset since the last recorded call,
+	// in which case Remaining is the full allowance and the reset time is
+	// unknown.
+	Stale bool
+
+	// Reports whether there is nothing to forecast from.
+	Unknown bool
+
+	// The downloads spent in the current period, by tool and user.
+	Spent []*LedgerSpending
+}
+
+// Forecasts the remaining quota at the given time from the last call recorded
+// in the ledger.
+func (l *DownloadLedger) Forecast(now time.Time) (*QuotaForecast, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var last *LedgerEntry
+	for _, e := range entries {
+		if !e.Cached && !e.ResetTimeUTC.IsZero() {
+			last = e
+		}
+	}
+	if last == nil {
+		return &QuotaForecast{Unknown: true}, nil
+	}
+
+	f := &QuotaForecast{
+		Remaining: last.Remaining,
+		Allowed: last.Remaining + last.Requests,
+		ResetTimeUTC: last.ResetTimeUTC,
+	}
+	if f.Remaining < 0 {
+		f.Remaining = 0
+	}
+
+	start := last.ResetTimeUTC.Add(-quotaPeriod)
+	if !now.Before(last.ResetTimeUTC) {
+		f.Remaining = f.Allowed
+		f.ResetTimeUTC = time.Time{}
+		f.Stale = true
+		start = last.ResetTimeUTC
+	}
+
+	f.Spent = spending(entries, start)
+
+	return f, nil
+}
+
+// Returns the downloads spent since the given time, by tool and user.
+func (l *DownloadLedger) Spending(since time.Time) ([]*LedgerSpending, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return spending(entries, since), nil
+}
+
+func spending(entries []*LedgerEntry, since time.Time) []*LedgerSpending {
+	var r []*LedgerSpending
+	m := map[[2]string]*LedgerSpending{}
+	for _, e := range entries {
+		if e.Cached || e.Refused || e.Time.Before(since) {
+			continue
+		}
+		k := [2]string{e.Tool, e.User}
+		s, ok := m[k]
+		if !ok {
+			s = &LedgerSpending{Tool: e.Tool, User: e.User}
+			m[k] = s
+			r = append(r, s)
+		}
+		s.Downloads += 1
+	}
+	sort.SliceStable(r, func (i, j int) bool {
+		return r[i].Downloads > r[j].Downloads
+	})
+	return r
+}
+
+// Requests a download URL like SubtitlesService.Download does, through a
+// client that records the call in the ledger under the subtitle.
+func (l *DownloadLedger) Download(ctx context.Context, s *SubtitlesService, p *SubtitlesDownloadParameters, subtitleID ID) (*SubtitlesDownloadResponse, *Response, error) {
+	return l.service(s).Download(ContextWithSubtitleID(ctx, subtitleID), p)
+}
+
+// Downloads the content of a subtitle like SubtitlesService.DownloadFile does,
+// through a client that records it in the ledger under the subtitle.
+func (l *DownloadLedger) DownloadFile(ctx context.Context, s *SubtitlesService, p *SubtitlesDownloadParameters, subtitleID ID, w io.Writer) (*CachedFile, *Response, error) {
+	return l.service(s).DownloadFile(ContextWithSubtitleID(ctx, subtitleID), p, w)
+}
+
+// Returns the service of a client that records its downloads in the ledger.
+func (l *DownloadLedger) service(s *SubtitlesService) *SubtitlesService {
+	if s.client.DownloadLedger == l {
+		return s
+	}
+	c := s.client.copy()
+	c.DownloadLedger = l
+	return c.Subtitles
+}
+
+func (l *DownloadLedger) checkReserve() error {
+	if l.Reserve <= 0 {
+		return nil
+	}
+	f, err := l.Forecast(time.Now())
+	if err != nil {
+		return err
+	}
+	if !f.Unknown && f.Remaining <= l.Reserve {
+		return &ReserveError{
+			Remaining: f.Remaining,
+			Reserve: l.Reserve,
+		}
+	}
+	return nil
+}
+
+// Records a call to the server if the quota is known from its response or its
+// error, and returns the error of the record.
+func (l *DownloadLedger) recordCall(ctx context.Context, p *SubtitlesDownloadParameters, res *Response, err error) error {
+	e := &LedgerEntry{
+		FileID: p.FileID,
+		SubtitleID: subtitleIDFrom(ctx),
+	}
+
+	var qe *QuotaError
+	switch {
+	case err == nil && res != nil:
+		e.Remaining = res.Quota.Remaining
+		e.Requests = res.Quota.Requests
+		e.ResetTimeUTC = res.Quota.ResetTimeUTC
+	case AsError(err, &qe):
+		e.Remaining = qe.Remaining
+		e.Requests = qe.Requests
+		e.ResetTimeUTC = qe.ResetTimeUTC
+		e.Refused = true
+	default:
+		return nil
+	}
+	return l.Record(e)
+}
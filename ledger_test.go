@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadLedgerRecord_AppendsEntries(t *testing.T) {
+	l := NewDownloadLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	l.Tool = "cli"
+
+	a, err := l.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	err = l.Record(&LedgerEntry{FileID: 1, Remaining: 9})
+	require.NoError(t, err)
+	err = l.Record(&LedgerEntry{FileID: 2, Remaining: 8, Tool: "cron"})
+	require.NoError(t, err)
+
+	a, err = l.Entries()
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	assert.Equal(t, ID(1), a[0].FileID)
+	assert.Equal(t, "cli", a[0].Tool)
+	assert.Equal(t, "cron", a[1].Tool)
+	assert.False(t, a[0].Time.IsZero())
+}
+
+func TestDownloadLedgerForecast_ForecastsTheQuota(t *testing.T) {
+	l := NewDownloadLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reset := now.Add(6 * time.Hour)
+
+	f, err := l.Forecast(now)
+	require.NoError(t, err)
+	assert.True(t, f.Unknown)
+
+	entries := []*LedgerEntry{
+		{Time: now.Add(-30 * time.Hour), Remaining: 0, Requests: 20, ResetTimeUTC: now.Add(-18 * time.Hour), Tool: "old"},
+		{Time: now.Add(-2 * time.Hour), Remaining: 19, Requests: 1, ResetTimeUTC: reset, Tool: "a"},
+		{Time: now.Add(-1 * time.Hour), Remaining: 18, Requests: 2, ResetTimeUTC: reset, Tool: "b"},
+		{Time: now.Add(-1 * time.Hour), Tool: "b", Cached: true},
+		{Time: now, Remaining: 17, Requests: 3, ResetTimeUTC: reset, Tool: "b"},
+	}
+	for _, e := range entries {
+		err = l.Record(e)
+		require.NoError(t, err)
+	}
+
+	f, err = l.Forecast(now)
+	require.NoError(t, err)
+	assert.Equal(t, 17, f.Remaining)
+	assert.Equal(t, 20, f.Allowed)
+	assert.Equal(t, reset, f.ResetTimeUTC)
+	assert.False(t, f.Stale)
+	assert.Equal(t, []*LedgerSpending{
+		{Tool: "b", Downloads: 2},
+		{Tool: "a", Downloads: 1},
+	}, f.Spent)
+
+	f, err = l.Forecast(reset.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 20, f.Remaining)
+	assert.True(t, f.Stale)
+	assert.Empty(t, f.Spent)
+}
+
+func TestDownloadLedgerDownload_RecordsAndRefuses(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	remaining := 3
+	m.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		remaining -= 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"link": "x", "remaining": %d, "requests": %d, "reset_time_utc": %q}`, remaining, 3 - remaining, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	})
+
+	l := NewDownloadLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	l.Reserve = 1
+
+	ctx := context.Background()
+	_, _, err := l.Download(ctx, c.Subtitles, &SubtitlesDownloadParameters{FileID: 1}, 10)
+	require.NoError(t, err)
+	_, _, err = l.Download(ctx, c.Subtitles, &SubtitlesDownloadParameters{FileID: 2}, 20)
+	require.NoError(t, err)
+	_, _, err = l.Download(ctx, c.Subtitles, &SubtitlesDownloadParameters{FileID: 3}, 30)
+	assert.Equal(t, &ReserveError{Remaining: 1, Reserve: 1}, err)
+	assert.EqualError(t, err, "rest: download would exceed the quota reserve of 1, 1 remaining")
+
+	a, err := l.Entries()
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	assert.Equal(t, ID(2), a[1].FileID)
+	assert.Equal(t, ID(20), a[1].SubtitleID)
+	assert.Equal(t, 1, a[1].Remaining)
+	assert.Equal(t, 2, a[1].Requests)
+}
+
+func TestSubtitlesServiceDownload_RecordsInTheLedgerOfTheClient(t *testing.T) {
+	c, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	l := NewDownloadLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	c.DownloadLedger = l
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	_, _, err := c.Subtitles.DownloadToPath(ctx, &SubtitlesDownloadParameters{FileID: 1}, filepath.Join(dir, "a.srt"), nil)
+	require.NoError(t, err)
+	p := &Provenance{SubtitleID: 20, FileID: 2}
+	p.Parameters.FileID = 2
+	_, _, err = c.Subtitles.DownloadWithProvenance(ctx, p, filepath.Join(dir, "b.srt"), nil)
+	require.NoError(t, err)
+
+	a, err := l.Entries()
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	assert.Equal(t, ID(1), a[0].FileID)
+	assert.Equal(t, ID(2), a[1].FileID)
+	assert.Equal(t, ID(20), a[1].SubtitleID)
+
+	err = l.Record(&LedgerEntry{FileID: 3, Remaining: 1, ResetTimeUTC: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	l.Reserve = 1
+	_, _, err = c.Subtitles.DownloadToPath(ctx, &SubtitlesDownloadParameters{FileID: 4}, filepath.Join(dir, "c.srt"), nil)
+	assert.Equal(t, &ReserveError{Remaining: 1, Reserve: 1}, err)
+	assert.Equal(t, 2, *n)
+}
@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	LockOK        = "ok"
+	LockMissing   = "missing"
+	LockModified  = "modified"
+	LockUntracked = "untracked"
+	LockRestored  = "restored"
+	LockFailed    = "failed"
+
+	lockfileVersion = 1
+)
+
+// Pins the subtitle files of a library, so the exact same files can be
+// verified and downloaded again on another machine. The paths are relative to
+// the root of the library and use forward slashes.
+type Lockfile struct {
+	Version   int          `json:"version"`
+	Subtitles []*LockEntry `json:"subtitles"`
+}
+
+type LockEntry struct {
+	Path       string                      `json:"path"`
+	Video      string                      `json:"video,omitempty"`
+	SubtitleID ID                          `json:"subtitle_id,omitempty"`
+	FileID     ID                          `json:"file_id"`
+	Parameters SubtitlesDownloadParameters `json:"parameters"`
+	SHA256     string                      `json:"sha256"`
+	Size       int64                       `json:"size"`
+}
+
+// The state of a pinned or an untracked subtitle.
+type LockStatus struct {
+	Path   string     `json:"path"`
+	Status string     `json:"status"`
+	Entry  *LockEntry `json:"entry,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// Pins the subtitles of the library that have a provenance. A subtitle that
+// has been edited since its download cannot be pinned, because it could not be
+// downloaded again.
+func GenerateLockfile(root string) (*Lockfile, error) {
+	subs, err := collectProvenance(root)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lockfile{
+		Version: lockfileVersion,
+		Subtitles: []*LockEntry{},
+	}
+	for _, ls := range subs {
+		if ls.Err != nil {
+			return nil, ls.Err
+		}
+		pv := ls.Provenance
+		edited, err := pv.Edited(ls.Path)
+		if err != nil {
+			return nil, err
+		}
+		if edited {
+			return nil, fmt.Errorf("rest: %q has been edited since it was downloaded", ls.Path)
+		}
+
+		e := &LockEntry{
+			SubtitleID: pv.SubtitleID,
+			FileID: pv.FileID,
+			Parameters: pv.Parameters,
+			SHA256: pv.SHA256,
+			Size: pv.Size,
+		}
+		e.Path, err = lockPath(root, ls.Path)
+		if err != nil {
+			return nil, err
+		}
+		if ls.Video != "" {
+			e.Video, err = lockPath(root, ls.Video)
+			if err != nil {
+				return nil, err
+			}
+		}
+		l.Subtitles = append(l.Subtitles, e)
+	}
+
+	sort.Slice(l.Subtitles, func (i, j int) bool {
+		return l.Subtitles[i].Path < l.Subtitles[j].Path
+	})
+
+	return l, nil
+}
+
+// Opens the lockfile.
+func OpenLockfile(name string) (*Lockfile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var l Lockfile
+	err = json.Unmarshal(data, &l)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot read the lockfile %q: %w", name, err)
+	}
+	if l.Version != lockfileVersion {
+		return nil, fmt.Errorf("rest: unsupported lockfile version %d", l.Version)
+	}
+	return &l, nil
+}
+
+// Saves the lockfile.
+func (l *Lockfile) Save(name string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, append(data, '\n'), 0644)
+}
+
+// Compares the library with the lockfile. Every pinned subtitle is reported as
+// ok, missing or modified, followed by the subtitles that have a provenance but
+// are not pinned, reported as untracked.
+func (l *Lockfile) Verify(root string) ([]*LockStatus, error) {
+	var r []*LockStatus
+	pinned := map[string]bool{}
+	for _, e := range l.Subtitles {
+		pinned[e.Path] = true
+		s, err := e.verify(root)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, s)
+	}
+
+	subs, err := collectProvenance(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, ls := range subs {
+		p, err := lockPath(root, ls.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !pinned[p] {
+			r = append(r, &LockStatus{Path: p, Status: LockUntracked})
+		}
+	}
+
+	return r, nil
+}
+
+func (e *LockEntry) verify(root string) (*LockStatus, error) {
+	s := &LockStatus{Path: e.Path, Entry: e}
+	path, err := e.path(root)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := checksumFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		s.Status = LockMissing
+	case err != nil:
+		return nil, err
+	case sum != e.SHA256:
+		s.Status = LockModified
+	default:
+		s.Status = LockOK
+	}
+	return s, nil
+}
+
+type RestoreParameters struct {
+	// Replaces the subtitles that have been modified. Without it, they are
+	// left as they are.
+	Force bool
+
+	// The least time to wait between two downloads, on top of the rate limit
+	// reported by the server.
+	Interval time.Duration
+}
+
+// Downloads the missing subtitles of the lockfile, and the modified ones with
+// Force. The content must match the checksum that is pinned, or the subtitle
+// is not written. The subtitles are downloaded through the download cache of
+// the client, if it has one, so pinned files that have been downloaded before
+// do not spend the quota. The run stops at the first QuotaError.
+func (s *SubtitlesService) Restore(ctx context.Context, l *Lockfile, root string, p *RestoreParameters) ([]*LockStatus, error) {
+	if p == nil {
+		p = &RestoreParameters{}
+	}
+
+	var r []*LockStatus
+	var last *Response
+	for _, e := range l.Subtitles {
+		st, err := e.verify(root)
+		if err != nil {
+			return r, err
+		}
+		r = append(r, st)
+		if st.Status == LockOK || st.Status == LockModified && !p.Force {
+			continue
+		}
+
+		if last != nil {
+			err = waitForRate(ctx, last, p.Interval)
+			if err != nil {
+				return r, err
+			}
+		}
+
+		res, err := s.restore(ctx, e, root)
+		if res != nil {
+			last = res
+		}
+		if err != nil {
+			st.Status = LockFailed
+			st.Error = err.Error()
+			var qe *QuotaError
+			if ctx.Err() != nil || AsError(err, &qe) {
+				return r, err
+			}
+			continue
+		}
+		st.Status = LockRestored
+	}
+
+	return r, nil
+}
+
+// Downloads the pinned subtitle and writes it along with its checksum and its
+// provenance. Content that does not match the checksum is removed from the
+// download cache, so it is downloaded again on the next run.
+func (s *SubtitlesService) restore(ctx context.Context, e *LockEntry, root string) (*Response, error) {
+	path, err := e.path(root)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *Response
+	err = writeAtomic(path, 0644, func (w io.Writer) error {
+		var b bytes.Buffer
+		var err error
+		_, res, err = s.DownloadFile(ContextWithSubtitleID(ctx, e.SubtitleID), &e.Parameters, &b)
+		if err != nil {
+			return err
+		}
+		sum := checksum(b.Bytes())
+		if sum != e.SHA256 {
+			if c := s.client.DownloadCache; c != nil {
+				c.Remove(&e.Parameters)
+			}
+			return fmt.Errorf("rest: %q does not match the lockfile, got %s, want %s", e.Path, sum, e.SHA256)
+		}
+		_, err = w.Write(b.Bytes())
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+
+	err = writeChecksumFile(path, e.SHA256)
+	if err != nil {
+		return res, err
+	}
+
+	pv := &Provenance{
+		SubtitleID: e.SubtitleID,
+		FileID: e.FileID,
+		Parameters: e.Parameters,
+		SHA256: e.SHA256,
+		Size: e.Size,
+		DownloadedAt: time.Now().UTC(),
+	}
+	return res, WriteProvenance(path, pv)
+}
+
+// Returns the path of the pinned subtitle in the library. The lockfile may come
+// from anywhere, so a path that leads out of the library is rejected.
+func (e *LockEntry) path(root string) (string, error) {
+	p := filepath.Clean(filepath.FromSlash(e.Path))
+	if p == "." || p == ".." || filepath.IsAbs(p) || filepath.VolumeName(p) != "" ||
+		strings.HasPrefix(p, ".."+string(filepath.Separator)) || strings.HasPrefix(p, string(filepath.Separator)) {
+		return "", fmt.Errorf("rest: lockfile path %q is outside the library", e.Path)
+	}
+	return filepath.Join(root, p), nil
+}
+
+func lockPath(root, path string) (string, error) {
+	p, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(p), nil
+}
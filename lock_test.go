@@ -0,0 +1,260 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLockSubtitle(t *testing.T, path string, id ID, content string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(path, []byte(content), 0644)
+	require.NoError(t, err)
+	p := &Provenance{SubtitleID: id * 10, FileID: id, SHA256: checksum([]byte(content)), Size: int64(len(content))}
+	p.Parameters.FileID = id
+	err = WriteProvenance(path, p)
+	require.NoError(t, err)
+}
+
+func TestGenerateLockfile_PinsTheSubtitlesWithAProvenance(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "b"), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(root, "b", "Movie.mkv"), nil, 0644)
+	require.NoError(t, err)
+	writeLockSubtitle(t, filepath.Join(root, "b", "Movie.en.srt"), 2, "subtitle")
+	writeLockSubtitle(t, filepath.Join(root, "a", "Show.en.srt"), 1, "subtitle")
+	err = os.WriteFile(filepath.Join(root, "a", "Other.en.srt"), nil, 0644)
+	require.NoError(t, err)
+
+	l, err := GenerateLockfile(root)
+	require.NoError(t, err)
+	require.Len(t, l.Subtitles, 2)
+	assert.Equal(t, 1, l.Version)
+
+	e := l.Subtitles[0]
+	assert.Equal(t, "a/Show.en.srt", e.Path)
+	assert.Equal(t, "", e.Video)
+	assert.Equal(t, ID(1), e.FileID)
+	assert.Equal(t, ID(10), e.SubtitleID)
+	assert.Equal(t, ID(1), e.Parameters.FileID)
+	assert.Equal(t, checksum([]byte("subtitle")), e.SHA256)
+	assert.Equal(t, int64(8), e.Size)
+
+	e = l.Subtitles[1]
+	assert.Equal(t, "b/Movie.en.srt", e.Path)
+	assert.Equal(t, "b/Movie.mkv", e.Video)
+
+	name := filepath.Join(t.TempDir(), "subtitles.lock")
+	err = l.Save(name)
+	require.NoError(t, err)
+	o, err := OpenLockfile(name)
+	require.NoError(t, err)
+	assert.Equal(t, l, o)
+}
+
+func TestGenerateLockfile_RefusesAnEditedSubtitle(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "Movie.en.srt")
+	writeLockSubtitle(t, path, 1, "subtitle")
+	err := os.WriteFile(path, []byte("edited"), 0644)
+	require.NoError(t, err)
+
+	_, err = GenerateLockfile(root)
+	assert.Error(t, err)
+}
+
+func TestLockfileVerify_ReportsTheLocalState(t *testing.T) {
+	root := t.TempDir()
+	writeLockSubtitle(t, filepath.Join(root, "A.en.srt"), 1, "a")
+	writeLockSubtitle(t, filepath.Join(root, "B.en.srt"), 2, "b")
+	writeLockSubtitle(t, filepath.Join(root, "C.en.srt"), 3, "c")
+
+	l, err := GenerateLockfile(root)
+	require.NoError(t, err)
+
+	writeLockSubtitle(t, filepath.Join(root, "D.en.srt"), 4, "d")
+	err = os.Remove(filepath.Join(root, "B.en.srt"))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(root, "C.en.srt"), []byte("edited"), 0644)
+	require.NoError(t, err)
+
+	r, err := l.Verify(root)
+	require.NoError(t, err)
+	require.Len(t, r, 4)
+	assert.Equal(t, "A.en.srt", r[0].Path)
+	assert.Equal(t, LockOK, r[0].Status)
+	assert.Equal(t, LockMissing, r[1].Status)
+	assert.Equal(t, LockModified, r[2].Status)
+	assert.Equal(t, "D.en.srt", r[3].Path)
+	assert.Equal(t, LockUntracked, r[3].Status)
+	assert.Nil(t, r[3].Entry)
+}
+
+func TestSubtitlesServiceRestore_DownloadsThePinnedFiles(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	src := t.TempDir()
+	writeLockSubtitle(t, filepath.Join(src, "a", "Movie.en.srt"), 1, "subtitle")
+	writeLockSubtitle(t, filepath.Join(src, "b", "Show.en.srt"), 2, "subtitle")
+	l, err := GenerateLockfile(src)
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	err = os.Mkdir(filepath.Join(root, "b"), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(root, "b", "Show.en.srt"), []byte("edited"), 0644)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	r, err := client.Subtitles.Restore(ctx, l, root, nil)
+	require.NoError(t, err)
+	require.Len(t, r, 2)
+	assert.Equal(t, LockRestored, r[0].Status)
+	assert.Equal(t, LockModified, r[1].Status)
+	assert.Equal(t, 1, *n)
+
+	data, err := os.ReadFile(filepath.Join(root, "a", "Movie.en.srt"))
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", string(data))
+	_, ok, err := FileUnchanged(filepath.Join(root, "a", "Movie.en.srt"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	p, err := ReadProvenance(filepath.Join(root, "a", "Movie.en.srt"))
+	require.NoError(t, err)
+	assert.Equal(t, ID(1), p.FileID)
+
+	r, err = client.Subtitles.Restore(ctx, l, root, &RestoreParameters{Force: true})
+	require.NoError(t, err)
+	assert.Equal(t, LockOK, r[0].Status)
+	assert.Equal(t, LockRestored, r[1].Status)
+	assert.Equal(t, 2, *n)
+
+	r, err = l.Verify(root)
+	require.NoError(t, err)
+	for _, s := range r {
+		assert.Equal(t, LockOK, s.Status, s.Path)
+	}
+}
+
+func TestSubtitlesServiceRestore_RefusesAMismatch(t *testing.T) {
+	client, _, teardown := setupDownload("different")
+	defer teardown()
+
+	src := t.TempDir()
+	writeLockSubtitle(t, filepath.Join(src, "Movie.en.srt"), 1, "subtitle")
+	l, err := GenerateLockfile(src)
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	r, err := client.Subtitles.Restore(context.Background(), l, root, nil)
+	require.NoError(t, err)
+	assert.Equal(t, LockFailed, r[0].Status)
+	assert.Contains(t, r[0].Error, "does not match the lockfile")
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSubtitlesServiceRestore_DownloadsAMismatchAgain(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	content := "different"
+	n := 0
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file_name": "a.srt", "link": "%sfile"}`, client.BaseURL)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	})
+
+	c, err := OpenDownloadCache(t.TempDir(), 0)
+	require.NoError(t, err)
+	client.DownloadCache = c
+
+	src := t.TempDir()
+	writeLockSubtitle(t, filepath.Join(src, "Movie.en.srt"), 1, "subtitle")
+	l, err := GenerateLockfile(src)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	root := t.TempDir()
+	r, err := client.Subtitles.Restore(ctx, l, root, nil)
+	require.NoError(t, err)
+	assert.Equal(t, LockFailed, r[0].Status)
+	assert.False(t, c.Contains(&l.Subtitles[0].Parameters))
+
+	content = "subtitle"
+	r, err = client.Subtitles.Restore(ctx, l, root, nil)
+	require.NoError(t, err)
+	assert.Equal(t, LockRestored, r[0].Status)
+	assert.Equal(t, 2, n)
+}
+
+func TestSubtitlesServiceRestore_RejectsAPathOutsideTheLibrary(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "library")
+	ctx := context.Background()
+
+	for _, path := range []string{"../outside.srt", "a/../../outside.srt", "/outside.srt", "..", "."} {
+		l := &Lockfile{
+			Version: 1,
+			Subtitles: []*LockEntry{
+				{Path: path, FileID: 1, Parameters: SubtitlesDownloadParameters{FileID: 1}, SHA256: checksum([]byte("subtitle"))},
+			},
+		}
+		_, err := client.Subtitles.Restore(ctx, l, root, nil)
+		assert.ErrorContains(t, err, "outside the library", path)
+	}
+	assert.Equal(t, 0, *n)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSubtitlesServiceRestore_UsesTheDownloadCache(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	c, err := OpenDownloadCache(t.TempDir(), 0)
+	require.NoError(t, err)
+	client.DownloadCache = c
+
+	src := t.TempDir()
+	writeLockSubtitle(t, filepath.Join(src, "Movie.en.srt"), 1, "subtitle")
+	l, err := GenerateLockfile(src)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i += 1 {
+		r, err := client.Subtitles.Restore(ctx, l, t.TempDir(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, LockRestored, r[0].Status)
+	}
+	assert.Equal(t, 1, *n)
+}
+
+func TestOpenLockfile_RejectsAnUnknownVersion(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "subtitles.lock")
+	err := os.WriteFile(name, []byte(`{"version": 2}`), 0644)
+	require.NoError(t, err)
+
+	_, err = OpenLockfile(name)
+	assert.Error(t, err)
+}
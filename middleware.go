@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+)
+
+// Sends a request and returns the parsed response and the classified error,
+// the same way BareDo does.
+type RequestHandler func (ctx context.Context, req *http.Request) (*Response, error)
+
+// Wraps the next handler of the chain. A middleware can change the request
+// before it calls the next handler, inspect or replace the response and the
+// error after it, call it several times to retry, or not call it at all to
+// serve the response by itself.
+type Middleware func (next RequestHandler) RequestHandler
+
+// Appends middleware to the chain of the client. The middleware added first is
+// the outermost, so it sees the request first and the response last. It is not
+// safe to call Use concurrently with requests.
+func (c *Client) Use(m ...Middleware) {
+	c.middleware = append(c.middleware, m...)
+}
+
+// Appends middleware to the chain that fetches the download links. The links
+// point outside of the API, so they are fetched with a plain GET that skips the
+// chain of Use, and only the middleware added here sees them. It is not safe to
+// call UseForLinks concurrently with requests.
+func (c *Client) UseForLinks(m ...Middleware) {
+	c.linkMiddleware = append(c.linkMiddleware, m...)
+}
+
+func (c *Client) handler(dt *decodeTarget) RequestHandler {
+	h := RequestHandler(func (ctx context.Context, req *http.Request) (*Response, error) {
+		_, ok := ctx.Value(apiKeyContextKey).(string)
+		if c.APIKeyPool != nil && !ok {
+			return c.doWithKeyPool(ctx, req, dt)
+		}
+		return c.bareDo(ctx, req, dt)
+	})
+	if c.CircuitBreaker != nil {
+		next := h
+		h = func (ctx context.Context, req *http.Request) (*Response, error) {
+			return c.doWithBreaker(ctx, req, next)
+		}
+	}
+	for i := len(c.middleware) - 1; i >= 0; i -= 1 {
+		h = c.middleware[i](h)
+	}
+	return h
+}
+
+// Returns the chain that fetches the download links.
+func (c *Client) linkHandler() RequestHandler {
+	h := RequestHandler(c.plainDo)
+	for i := len(c.linkMiddleware) - 1; i >= 0; i -= 1 {
+		h = c.linkMiddleware[i](h)
+	}
+	return h
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUse_ChainsTheMiddlewareInOrder(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/hi", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.Header.Get("X-First"))
+		w.Header().Set(headerRateRemaining, "3")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+	})
+
+	var calls []string
+	trace := func (name string) Middleware {
+		return func (next RequestHandler) RequestHandler {
+			return func (ctx context.Context, req *http.Request) (*Response, error) {
+				calls = append(calls, name + " before")
+				if name == "first" {
+					req.Header.Set("X-First", "1")
+				}
+				res, err := next(ctx, req)
+				calls = append(calls, name + " after")
+				if name == "second" {
+					assert.Equal(t, 3, res.Rate.Remaining)
+					assert.True(t, isRateLimitError(err))
+				}
+				return res, err
+			}
+		}
+	}
+	c.Use(trace("first"), trace("second"))
+
+	u, err := c.NewURL("hi", nil)
+	require.NoError(t, err)
+	req, err := c.NewRequest("GET", u, nil)
+	require.NoError(t, err)
+
+	_, err = c.Do(context.Background(), req, nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, calls)
+
+	calls = nil
+	cp := c.WithAuthToken("xxx")
+	_, _ = cp.Do(context.Background(), req, nil)
+	assert.Len(t, calls, 4)
+}
+
+func TestUse_AllowsServingTheResponse(t *testing.T) {
+	c := NewClient(nil)
+	c.Use(func (next RequestHandler) RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*Response, error) {
+			return &Response{
+				Response: &http.Response{
+					StatusCode: http.StatusOK,
+					Body: toBody(`{"a": 1}`),
+				},
+			}, nil
+		}
+	})
+
+	req, err := c.NewRequest("GET", "http://localhost:0/", nil)
+	require.NoError(t, err)
+
+	var a map[string]int
+	_, err = c.Do(context.Background(), req, &a)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, a)
+}
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const moviehashChunkSize = 64 * 1024
+
+// Returned when a video is too small for the moviehash, which needs at least
+// one chunk.
+type VideoSizeError struct {
+	Size int64
+}
+
+func (e *VideoSizeError) Error() string {
+	return fmt.Sprintf("rest: video must be at least %d bytes, but it is %d", moviehashChunkSize, e.Size)
+}
+
+// Computes the OpenSubtitles hash of a video, which is the size of the video
+// plus the 64-bit sums of its first and last 64KB.
+//
+// [OpenSubtitles Reference]
+//
+// [OpenSubtitles Reference]: https://trac.opensubtitles.org/projects/opensubtitles/wiki/HashSourceCodes
+func Moviehash(r io.ReadSeeker) (string, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	if size < moviehashChunkSize {
+		return "", &VideoSizeError{Size: size}
+	}
+
+	h := uint64(size)
+	buf := make([]byte, moviehashChunkSize)
+
+	for _, off := range []int64{0, size - moviehashChunkSize} {
+		_, err = r.Seek(off, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < len(buf); i += 8 {
+			h += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+
+	return fmt.Sprintf("%016x", h), nil
+}
+
+// Computes the OpenSubtitles hash of a video file.
+func MoviehashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Moviehash(f)
+}
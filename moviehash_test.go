@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoviehash_HashesTheVideo(t *testing.T) {
+	b := make([]byte, 3 * moviehashChunkSize)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	b[0] = 1
+	b[len(b)-1] = 2
+
+	a, err := Moviehash(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, "a3601fdf9f620001", a)
+
+	n := filepath.Join(t.TempDir(), "video.mkv")
+	err = os.WriteFile(n, b, 0644)
+	require.NoError(t, err)
+
+	f, err := MoviehashFile(n)
+	require.NoError(t, err)
+	assert.Equal(t, a, f)
+}
+
+func TestMoviehash_ReturnsAnErrorIfTheVideoIsTooSmall(t *testing.T) {
+	_, err := Moviehash(bytes.NewReader([]byte("small")))
+	assert.EqualError(t, err, "rest: video must be at least 65536 bytes, but it is 5")
+	assert.Equal(t, &VideoSizeError{Size: 5}, err)
+}
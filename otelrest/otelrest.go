@@ -0,0 +1,116 @@
+// Bridges the instrumentation of the rest client to OpenTelemetry. It is a
+// separate module, so the client does not depend on OpenTelemetry.
+package otelrest
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/opensubtitlescli/rest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scope = "github.com/opensubtitlescli/rest/otelrest"
+
+// Reports the spans and metrics of a client to OpenTelemetry. Set it as the
+// Instrumentation of the client.
+type Instrumentation struct {
+	tracer   trace.Tracer
+	meter    metric.Meter
+	counters map[string]metric.Int64Counter
+	gauges   map[string]*gauge
+}
+
+// The last value of a gauge. Nothing is observed until there is one.
+type gauge struct {
+	value atomic.Int64
+	seen  atomic.Bool
+}
+
+// Creates the instrumentation with the providers. The rate and quota gauges
+// are observed asynchronously, and report the last value seen.
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Instrumentation, error) {
+	in := &Instrumentation{
+		tracer: tp.Tracer(scope),
+		meter: mp.Meter(scope),
+		counters: map[string]metric.Int64Counter{},
+		gauges: map[string]*gauge{},
+	}
+
+	for _, n := range []string{rest.MetricRequests, rest.MetricDownloads, rest.MetricCacheHits} {
+		c, err := in.meter.Int64Counter(n)
+		if err != nil {
+			return nil, err
+		}
+		in.counters[n] = c
+	}
+
+	for _, n := range []string{rest.MetricRateRemaining, rest.MetricQuotaRemaining} {
+		g := &gauge{}
+		_, err := in.meter.Int64ObservableGauge(n, metric.WithInt64Callback(
+			func (_ context.Context, o metric.Int64Observer) error {
+				if g.seen.Load() {
+					o.Observe(g.value.Load())
+				}
+				return nil
+			},
+		))
+		if err != nil {
+			return nil, err
+		}
+		in.gauges[n] = g
+	}
+
+	return in, nil
+}
+
+func (in *Instrumentation) StartSpan(ctx context.Context, s *rest.SpanStart) (context.Context, rest.Span) {
+	ctx, span := in.tracer.Start(
+		ctx,
+		s.Method + " " + s.Endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rest.endpoint", s.Endpoint),
+			attribute.String("http.request.method", s.Method),
+			attribute.String("url.full", s.URL),
+		),
+	)
+	return ctx, &otelSpan{span: span}
+}
+
+func (in *Instrumentation) Count(ctx context.Context, name string, n int64) {
+	c, ok := in.counters[name]
+	if ok {
+		c.Add(ctx, n)
+	}
+}
+
+func (in *Instrumentation) Gauge(ctx context.Context, name string, v int64) {
+	g, ok := in.gauges[name]
+	if ok {
+		g.value.Store(v)
+		g.seen.Store(true)
+	}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) End(e *rest.SpanEnd) {
+	if e.Status != 0 {
+		s.span.SetAttributes(attribute.Int("http.response.status_code", e.Status))
+	}
+	if e.Coalesced {
+		s.span.SetAttributes(attribute.Bool("rest.coalesced", true))
+	}
+	if e.Error != nil {
+		s.span.SetAttributes(attribute.String("error.type", e.ErrorClass))
+		s.span.RecordError(e.Error)
+		s.span.SetStatus(codes.Error, e.Error.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,79 @@
+package otelrest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/opensubtitlescli/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrumentation_ReportsToOpenTelemetry(t *testing.T) {
+	m := http.NewServeMux()
+	s := httptest.NewServer(m)
+	defer s.Close()
+
+	m.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5")
+		w.Header().Set("X-RateLimit-Remaining", "3")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+	})
+
+	e := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(e))
+	r := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(r))
+
+	in, err := New(tp, mp)
+	require.NoError(t, err)
+
+	c := rest.NewClient(nil)
+	c.BaseURL, _ = url.Parse(s.URL + "/")
+	c.Instrumentation = in
+
+	ctx := context.Background()
+	_, _, err = c.Users.Get(ctx)
+	require.Error(t, err)
+
+	spans := e.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET infos/user", span.Name)
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Contains(t, span.Attributes, attribute.String("rest.endpoint", "infos/user"))
+	assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", 429))
+	assert.Contains(t, span.Attributes, attribute.String("error.type", "RateLimitError"))
+
+	var rm metricdata.ResourceMetrics
+	err = r.Collect(ctx, &rm)
+	require.NoError(t, err)
+
+	values := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch d := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				values[m.Name] = d.DataPoints[0].Value
+			case metricdata.Gauge[int64]:
+				values[m.Name] = d.DataPoints[0].Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		rest.MetricRequests: 1,
+		rest.MetricRateRemaining: 3,
+	}, values)
+}
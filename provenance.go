@@ -0,0 +1,266 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const provenanceExtension = ".opensubtitles.json"
+
+// Records where a downloaded subtitle came from. It is written next to the
+// subtitle, so later runs can tell whether the file has been edited, skip the
+// download of the same file and look for a better-rated subtitle.
+type Provenance struct {
+	SubtitleID       ID        `json:"subtitle_id,omitempty"`
+	FileID           ID        `json:"file_id"`
+	FeatureID        ID        `json:"feature_id,omitempty"`
+	Language         string    `json:"language,omitempty"`
+	ForeignPartsOnly bool      `json:"foreign_parts_only,omitempty"`
+	HearingImpaired  bool      `json:"hearing_impaired,omitempty"`
+	Release          string    `json:"release,omitempty"`
+	Uploader         *Uploader `json:"uploader,omitempty"`
+	Ratings          float32   `json:"ratings,omitempty"`
+
+	// The moviehash of the video the subtitle was searched for, if any.
+	Moviehash string `json:"moviehash,omitempty"`
+
+	Parameters SubtitlesDownloadParameters `json:"parameters"`
+
+	// The checksum and the size of the content as it was downloaded.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// Builds the provenance of the first file of the subtitle. The checksum, the
+// size and the download time are filled in by DownloadWithProvenance.
+func NewProvenance(e *SubtitleEntity, moviehash string) (*Provenance, error) {
+	if e == nil || e.Attributes == nil || len(e.Attributes.Files) == 0 || e.Attributes.Files[0].FileID == nil {
+		return nil, errors.New("rest: subtitle has no file to download")
+	}
+	s := e.Attributes
+
+	p := &Provenance{
+		FileID: *s.Files[0].FileID,
+		Uploader: s.Uploader,
+		Moviehash: moviehash,
+	}
+	p.Parameters.FileID = p.FileID
+	if s.SubtitleID != nil {
+		p.SubtitleID = *s.SubtitleID
+	}
+	if s.FeatureDetails != nil && s.FeatureDetails.FeatureID != nil {
+		p.FeatureID = *s.FeatureDetails.FeatureID
+	}
+	if s.Language != nil {
+		p.Language = *s.Language
+	}
+	if s.ForeignPartsOnly != nil {
+		p.ForeignPartsOnly = *s.ForeignPartsOnly
+	}
+	if s.HearingImpaired != nil {
+		p.HearingImpaired = *s.HearingImpaired
+	}
+	if s.Release != nil {
+		p.Release = *s.Release
+	}
+	if s.Ratings != nil {
+		p.Ratings = *s.Ratings
+	}
+	return p, nil
+}
+
+// Returns the provenance written next to the subtitle.
+func ReadProvenance(path string) (*Provenance, error) {
+	data, err := os.ReadFile(path + provenanceExtension)
+	if err != nil {
+		return nil, err
+	}
+	var p Provenance
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot read the provenance of %q: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Writes the provenance next to the subtitle.
+func WriteProvenance(path string, p *Provenance) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path + provenanceExtension, append(data, '\n'), 0644)
+}
+
+// Reports whether the subtitle no longer has the content it was downloaded
+// with.
+func (p *Provenance) Edited(path string) (bool, error) {
+	sum, err := checksumFile(path)
+	if err != nil {
+		return false, err
+	}
+	return sum != p.SHA256, nil
+}
+
+// Returns the search that finds the other subtitles of the same video in the
+// same language.
+func (p *Provenance) SearchParameters() *SubtitlesSearchParameters {
+	sp := &SubtitlesSearchParameters{
+		ID: p.FeatureID,
+		Moviehash: p.Moviehash,
+	}
+	if p.Language != "" {
+		sp.Languages = []string{p.Language}
+	}
+	return sp
+}
+
+// Returns the best-rated of the subtitles that is rated higher than the one of
+// the provenance, in the same language and of the same kind, or nil if there is
+// none.
+func (p *Provenance) BetterRated(d []*SubtitleEntity) *SubtitleEntity {
+	var best *SubtitleEntity
+	r := p.Ratings
+	for _, e := range d {
+		if e == nil || e.Attributes == nil || e.Attributes.Ratings == nil {
+			continue
+		}
+		s := e.Attributes
+		if p.same(s) || !p.sameKind(s) {
+			continue
+		}
+		if *s.Ratings > r {
+			best = e
+			r = *s.Ratings
+		}
+	}
+	return best
+}
+
+// Reports whether the subtitle is the one of the provenance.
+func (p *Provenance) same(s *Subtitle) bool {
+	return s.SubtitleID != nil && *s.SubtitleID == p.SubtitleID
+}
+
+// Reports whether the subtitle is in the same language and of the same kind as
+// the one of the provenance.
+func (p *Provenance) sameKind(s *Subtitle) bool {
+	return s.Language != nil && strings.EqualFold(*s.Language, p.Language) &&
+		(s.ForeignPartsOnly != nil && *s.ForeignPartsOnly) == p.ForeignPartsOnly &&
+		(s.HearingImpaired != nil && *s.HearingImpaired) == p.HearingImpaired
+}
+
+// Downloads the subtitle of the provenance to the path like DownloadToPath
+// does, and writes the provenance next to it. The download is skipped if the
+// path already holds the same file, downloaded with the same parameters and
+// unedited. A file that is the unedited download of another subtitle, or of the
+// same one with other parameters, is replaced.
+func (s *SubtitlesService) DownloadWithProvenance(ctx context.Context, p *Provenance, path string, o *DownloadToPathParameters) (*DownloadedFile, *Response, error) {
+	if o == nil {
+		o = &DownloadToPathParameters{}
+	}
+
+	old, err := ReadProvenance(path)
+	switch {
+	case err == nil:
+		edited, err := old.Edited(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+		if err != nil || edited {
+			break
+		}
+		if old.FileID == p.FileID && old.Parameters == p.Parameters && !o.Overwrite {
+			d := &DownloadedFile{Path: path, SHA256: old.SHA256, Size: old.Size, Skipped: true}
+			return d, nil, nil
+		}
+		c := *o
+		c.Overwrite = true
+		o = &c
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return nil, nil, err
+	}
+
+	ctx = ContextWithSubtitleID(ctx, p.SubtitleID)
+	d, res, err := s.DownloadToPath(ctx, &p.Parameters, path, o)
+	if err != nil || d.Skipped {
+		return d, res, err
+	}
+
+	p.SHA256 = d.SHA256
+	p.Size = d.Size
+	p.DownloadedAt = time.Now().UTC()
+	err = WriteProvenance(path, p)
+	if err != nil {
+		return nil, res, err
+	}
+	return d, res, nil
+}
+
+// A subtitle in a library that has a provenance, paired with its video.
+type localSubtitle struct {
+	Path       string
+	Video      string
+	Provenance *Provenance
+
+	// The error of reading the provenance.
+	Err error
+}
+
+// Walks the directory for the subtitles that have a provenance, and pairs
+// them with the videos they lie next to.
+func collectProvenance(root string) ([]*localSubtitle, error) {
+	var subs []string
+	videos := map[string][]string{}
+
+	err := filepath.WalkDir(root, func (path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case videoExtensions[ext]:
+			dir := filepath.Dir(path)
+			videos[dir] = append(videos[dir], path)
+		case subtitleExtensions[ext]:
+			subs = append(subs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*localSubtitle
+	for _, sub := range subs {
+		pv, err := ReadProvenance(sub)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		ls := &localSubtitle{Path: sub, Provenance: pv, Err: err}
+		for _, v := range videos[filepath.Dir(sub)] {
+			if ParseSidecar(v, sub) != nil {
+				ls.Video = v
+				break
+			}
+		}
+		r = append(r, ls)
+	}
+	return r, nil
+}
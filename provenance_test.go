@@ -0,0 +1,185 @@
+package rest
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvenance_TakesTheAttributesOfTheSubtitle(t *testing.T) {
+	e := &SubtitleEntity{
+		Attributes: &Subtitle{
+			FeatureDetails: &FeatureDetails{FeatureID: AllocateID(3)},
+			Files: []*File{{FileID: AllocateID(2)}},
+			HearingImpaired: AllocateBool(true),
+			Language: AllocateString("en"),
+			Ratings: AllocateFloat32(7.5),
+			Release: AllocateString("Movie.2020.1080p"),
+			SubtitleID: AllocateID(1),
+			Uploader: &Uploader{Name: AllocateString("someone")},
+		},
+	}
+
+	p, err := NewProvenance(e, "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, ID(1), p.SubtitleID)
+	assert.Equal(t, ID(2), p.FileID)
+	assert.Equal(t, ID(2), p.Parameters.FileID)
+	assert.Equal(t, ID(3), p.FeatureID)
+	assert.Equal(t, "en", p.Language)
+	assert.True(t, p.HearingImpaired)
+	assert.False(t, p.ForeignPartsOnly)
+	assert.Equal(t, "Movie.2020.1080p", p.Release)
+	assert.Equal(t, "someone", *p.Uploader.Name)
+	assert.Equal(t, float32(7.5), p.Ratings)
+	assert.Equal(t, "0123456789abcdef", p.Moviehash)
+
+	sp := p.SearchParameters()
+	assert.Equal(t, ID(3), sp.ID)
+	assert.Equal(t, "0123456789abcdef", sp.Moviehash)
+	assert.Equal(t, []string{"en"}, sp.Languages)
+
+	_, err = NewProvenance(&SubtitleEntity{Attributes: &Subtitle{}}, "")
+	assert.Error(t, err)
+}
+
+func TestSubtitlesServiceDownloadWithProvenance_WritesAndReadsItBack(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &Provenance{FileID: 1, SubtitleID: 10, Language: "en"}
+	p.Parameters.FileID = 1
+
+	f, res, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.False(t, f.Skipped)
+
+	r, err := ReadProvenance(path)
+	require.NoError(t, err)
+	assert.Equal(t, ID(1), r.FileID)
+	assert.Equal(t, ID(10), r.SubtitleID)
+	assert.Equal(t, ID(1), r.Parameters.FileID)
+	assert.Equal(t, checksum([]byte("subtitle")), r.SHA256)
+	assert.Equal(t, int64(8), r.Size)
+	assert.False(t, r.DownloadedAt.IsZero())
+
+	edited, err := r.Edited(path)
+	require.NoError(t, err)
+	assert.False(t, edited)
+
+	f, res, err = client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+	assert.Nil(t, res)
+	assert.True(t, f.Skipped)
+	assert.Equal(t, 1, *n)
+}
+
+func TestSubtitlesServiceDownloadWithProvenance_KeepsALocalEdit(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &Provenance{FileID: 1}
+	p.Parameters.FileID = 1
+
+	_, _, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+
+	err = os.WriteFile(path, []byte("edited"), 0644)
+	require.NoError(t, err)
+
+	r, err := ReadProvenance(path)
+	require.NoError(t, err)
+	edited, err := r.Edited(path)
+	require.NoError(t, err)
+	assert.True(t, edited)
+
+	_, _, err = client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	assert.ErrorIs(t, err, fs.ErrExist)
+	assert.Equal(t, 1, *n)
+}
+
+func TestSubtitlesServiceDownloadWithProvenance_ReplacesAnotherUneditedSubtitle(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &Provenance{FileID: 1}
+	p.Parameters.FileID = 1
+
+	_, _, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+
+	p = &Provenance{FileID: 2}
+	p.Parameters.FileID = 2
+	f, _, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+	assert.False(t, f.Skipped)
+	assert.Equal(t, 2, *n)
+
+	r, err := ReadProvenance(path)
+	require.NoError(t, err)
+	assert.Equal(t, ID(2), r.FileID)
+}
+
+func TestSubtitlesServiceDownloadWithProvenance_ReplacesTheSameSubtitleWithOtherParameters(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	path := filepath.Join(t.TempDir(), "Movie.en.srt")
+	ctx := context.Background()
+	p := &Provenance{FileID: 1}
+	p.Parameters.FileID = 1
+
+	_, _, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+
+	p.Parameters.SubFormat = "webvtt"
+	f, _, err := client.Subtitles.DownloadWithProvenance(ctx, p, path, nil)
+	require.NoError(t, err)
+	assert.False(t, f.Skipped)
+	assert.Equal(t, 2, *n)
+
+	r, err := ReadProvenance(path)
+	require.NoError(t, err)
+	assert.Equal(t, "webvtt", r.Parameters.SubFormat)
+}
+
+func TestProvenanceBetterRated_PicksTheBestOfTheSameKind(t *testing.T) {
+	p := &Provenance{SubtitleID: 1, Language: "en", Ratings: 6}
+	d := []*SubtitleEntity{
+		{Attributes: &Subtitle{SubtitleID: AllocateID(1), Language: AllocateString("en"), Ratings: AllocateFloat32(10)}},
+		{Attributes: &Subtitle{SubtitleID: AllocateID(2), Language: AllocateString("de"), Ratings: AllocateFloat32(9)}},
+		{Attributes: &Subtitle{SubtitleID: AllocateID(3), Language: AllocateString("en"), Ratings: AllocateFloat32(9), HearingImpaired: AllocateBool(true)}},
+		{Attributes: &Subtitle{SubtitleID: AllocateID(4), Language: AllocateString("en"), Ratings: AllocateFloat32(7)}},
+		{Attributes: &Subtitle{SubtitleID: AllocateID(5), Language: AllocateString("EN"), Ratings: AllocateFloat32(8)}},
+		{Attributes: &Subtitle{SubtitleID: AllocateID(6), Language: AllocateString("en")}},
+		nil,
+	}
+
+	b := p.BetterRated(d)
+	require.NotNil(t, b)
+	assert.Equal(t, ID(5), *b.Attributes.SubtitleID)
+
+	p.Ratings = 8
+	assert.Nil(t, p.BetterRated(d))
+}
+
+func TestReadProvenance_RejectsAMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.srt")
+	err := os.WriteFile(path + provenanceExtension, []byte("{"), 0644)
+	require.NoError(t, err)
+
+	_, err = ReadProvenance(path)
+	assert.Error(t, err)
+}
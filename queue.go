@@ -0,0 +1,320 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	defaultQueueMaxAttempts = 3
+)
+
+type DownloadJob struct {
+	Parameters SubtitlesDownloadParameters `json:"parameters"`
+
+	// The path to save the subtitle to.
+	Path string `json:"path"`
+
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A queue of downloads that is persisted to a local file after every change, so
+// that it can be resumed after a crash.
+type DownloadQueue struct {
+	mu      sync.Mutex
+	name    string
+	jobs    []*DownloadJob
+	saveErr error
+}
+
+type downloadQueueFile struct {
+	Jobs []*DownloadJob `json:"jobs"`
+}
+
+// Opens the queue persisted to the file, or creates an empty one if the file
+// does not exist. Jobs that were running when the queue was last saved are
+// returned to the pending state.
+func OpenDownloadQueue(name string) (*DownloadQueue, error) {
+	q := &DownloadQueue{name: name}
+
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f downloadQueueFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot read the download queue %q: %w", name, err)
+	}
+
+	for _, j := range f.Jobs {
+		if j == nil {
+			continue
+		}
+		if j.Status == JobRunning {
+			j.Status = JobPending
+		}
+		q.jobs = append(q.jobs, j)
+	}
+
+	return q, nil
+}
+
+// Adds a download to the queue. If a job for the same file ID is already in the
+// queue, it is returned instead and the second result is false.
+func (q *DownloadQueue) Add(p *SubtitlesDownloadParameters, path string) (*DownloadJob, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, j := range q.jobs {
+		if j.Parameters.FileID == p.FileID {
+			c := *j
+			return &c, false, nil
+		}
+	}
+
+	j := &DownloadJob{
+		Parameters: *p,
+		Path: path,
+		Status: JobPending,
+		UpdatedAt: time.Now().UTC(),
+	}
+	q.jobs = append(q.jobs, j)
+
+	err := q.save()
+	if err != nil {
+		q.jobs = q.jobs[:len(q.jobs)-1]
+		return nil, false, err
+	}
+
+	c := *j
+	return &c, true, nil
+}
+
+// Returns copies of the jobs in the order they were added.
+func (q *DownloadQueue) Jobs() []*DownloadJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r := make([]*DownloadJob, len(q.jobs))
+	for i, j := range q.jobs {
+		c := *j
+		r[i] = &c
+	}
+	return r
+}
+
+// Returns the number of jobs in each status.
+func (q *DownloadQueue) Stats() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r := map[string]int{}
+	for _, j := range q.jobs {
+		r[j.Status] += 1
+	}
+	return r
+}
+
+type DownloadQueueRunParameters struct {
+	// Returns the QuotaError instead of waiting until the quota is reset.
+	NoWait bool
+
+	// The number of attempts after which a job is marked as failed. Defaults to
+	// 3.
+	MaxAttempts int
+
+	// The least time to wait between two downloads, on top of the rate limit
+	// reported by the server.
+	Interval time.Duration
+
+	// Is called after every change of a job status.
+	Progress func (*DownloadJob)
+}
+
+// Runs the pending jobs one by one until there are none left or the context is
+// done. When the download quota is exhausted, the current job is returned to
+// the pending state and the run waits until the quota is reset, or stops with
+// the QuotaError if NoWait is set.
+func (q *DownloadQueue) Run(ctx context.Context, s *SubtitlesService, p *DownloadQueueRunParameters) error {
+	if p == nil {
+		p = &DownloadQueueRunParameters{}
+	}
+	max := p.MaxAttempts
+	if max <= 0 {
+		max = defaultQueueMaxAttempts
+	}
+
+	var last *Response
+	for {
+		j := q.next()
+		if j == nil {
+			return nil
+		}
+
+		if last != nil {
+			err := waitForRate(ctx, last, p.Interval)
+			if err != nil {
+				q.update(j, JobPending, nil, p.Progress)
+				return err
+			}
+		}
+
+		res, err := s.downloadTo(ctx, &j.Parameters, j.Path)
+		if res != nil {
+			last = res
+		}
+
+		var qe *QuotaError
+		var fe *FileError
+		switch {
+		case err == nil:
+			q.update(j, JobDone, nil, p.Progress)
+
+		case ctx.Err() != nil:
+			q.update(j, JobPending, nil, p.Progress)
+			return ctx.Err()
+
+		case AsError(err, &qe):
+			q.update(j, JobPending, err, p.Progress)
+			if p.NoWait {
+				return qe
+			}
+			t := qe.ResetTimeUTC
+			if !t.After(time.Now()) {
+				// The reset time is missing or has already passed, so wait a
+				// little to not spin on the same error.
+				t = time.Now().Add(time.Minute)
+			}
+			err = waitUntil(ctx, t)
+			if err != nil {
+				return err
+			}
+
+		case isRateLimitError(err):
+			q.update(j, JobPending, err, p.Progress)
+
+		case AsError(err, &fe):
+			q.update(j, JobFailed, err, p.Progress)
+
+		default:
+			q.mu.Lock()
+			j.Attempts += 1
+			a := j.Attempts
+			q.mu.Unlock()
+			if a >= max {
+				q.update(j, JobFailed, err, p.Progress)
+			} else {
+				q.update(j, JobPending, err, p.Progress)
+			}
+		}
+
+		err = q.lastSaveError()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (q *DownloadQueue) next() *DownloadJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Jobs that have already been attempted go after the fresh ones, so that a
+	// single broken job does not block the queue.
+	var n *DownloadJob
+	for _, j := range q.jobs {
+		if j.Status != JobPending {
+			continue
+		}
+		if n == nil || j.Attempts < n.Attempts {
+			n = j
+		}
+	}
+	if n == nil {
+		return nil
+	}
+
+	n.Status = JobRunning
+	n.UpdatedAt = time.Now().UTC()
+	q.saveErr = q.save()
+
+	return n
+}
+
+func (q *DownloadQueue) update(j *DownloadJob, status string, err error, progress func (*DownloadJob)) {
+	q.mu.Lock()
+	j.Status = status
+	j.UpdatedAt = time.Now().UTC()
+	j.Error = ""
+	if err != nil {
+		j.Error = err.Error()
+	}
+	q.saveErr = q.save()
+	c := *j
+	q.mu.Unlock()
+
+	if progress != nil {
+		progress(&c)
+	}
+}
+
+func (q *DownloadQueue) lastSaveError() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.saveErr
+}
+
+// Writes the queue to a temporary file and renames it over the previous one,
+// so that a crash never leaves a partially written queue behind.
+func (q *DownloadQueue) save() error {
+	data, err := json.MarshalIndent(&downloadQueueFile{Jobs: q.jobs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.name, data, 0644)
+}
+
+// Downloads the subtitle and saves it to the path.
+func (s *SubtitlesService) downloadTo(ctx context.Context, p *SubtitlesDownloadParameters, path string) (*Response, error) {
+	var res *Response
+	err := writeAtomic(path, 0644, func (w io.Writer) error {
+		var err error
+		_, res, err = s.DownloadFile(ctx, p, w)
+		return err
+	})
+	return res, err
+}
+
+func waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	tm := time.NewTimer(d)
+	defer tm.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-tm.C:
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenDownloadQueue_ResumesRunningJobs(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "queue.json")
+	err := os.WriteFile(n, []byte(`{"jobs": [
+		{"parameters": {"file_id": 1}, "path": "a.srt", "status": "running"},
+		{"parameters": {"file_id": 2}, "path": "b.srt", "status": "done"}
+	]}`), 0644)
+	require.NoError(t, err)
+
+	q, err := OpenDownloadQueue(n)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{JobPending: 1, JobDone: 1}, q.Stats())
+}
+
+func TestDownloadQueueAdd_DedupesTheFileID(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenDownloadQueue(n)
+	require.NoError(t, err)
+
+	_, ok, err := q.Add(&SubtitlesDownloadParameters{FileID: 1}, "a.srt")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	j, ok, err := q.Add(&SubtitlesDownloadParameters{FileID: 1, SubFormat: "vtt"}, "b.srt")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "a.srt", j.Path)
+
+	q, err = OpenDownloadQueue(n)
+	require.NoError(t, err)
+	assert.Len(t, q.Jobs(), 1)
+}
+
+func TestDownloadQueueRun_DownloadsTheJobs(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	d := t.TempDir()
+	quota := 1
+
+	m.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		var p SubtitlesDownloadParameters
+		err := json.NewDecoder(r.Body).Decode(&p)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case p.FileID == 3:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"message": "Invalid file_id"}`)
+		case quota == 0:
+			quota = 1
+			w.WriteHeader(http.StatusNotAcceptable)
+			fmt.Fprintf(w, `{"message": "You have downloaded your allowed 1 subtitles for 24h", "remaining": -1, "reset_time_utc": %q}`, time.Now().Add(200 * time.Millisecond).UTC().Format(time.RFC3339Nano))
+		default:
+			quota -= 1
+			fmt.Fprintf(w, `{"link": "%sfile/%d"}`, c.BaseURL, p.FileID)
+		}
+	})
+	m.HandleFunc("/file/", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+
+	q, err := OpenDownloadQueue(filepath.Join(d, "queue.json"))
+	require.NoError(t, err)
+	for i := 1; i <= 3; i += 1 {
+		_, _, err = q.Add(&SubtitlesDownloadParameters{FileID: ID(i)}, filepath.Join(d, fmt.Sprintf("%d.srt", i)))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	var s []string
+	err = q.Run(ctx, c.Subtitles, &DownloadQueueRunParameters{
+		Progress: func (j *DownloadJob) {
+			s = append(s, fmt.Sprintf("%d %s", j.Parameters.FileID, j.Status))
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1 done", "2 pending", "2 done", "3 failed"}, s)
+
+	b, err := os.ReadFile(filepath.Join(d, "2.srt"))
+	require.NoError(t, err)
+	assert.Equal(t, "/file/2", string(b))
+
+	q, err = OpenDownloadQueue(filepath.Join(d, "queue.json"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{JobDone: 2, JobFailed: 1}, q.Stats())
+}
+
+func TestDownloadQueueRun_StopsOnQuotaError(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotAcceptable)
+		fmt.Fprint(w, `{"message": "You have downloaded your allowed 1 subtitles for 24h", "remaining": -1, "reset_time_utc": "2100-01-01T00:00:00Z"}`)
+	})
+
+	d := t.TempDir()
+	q, err := OpenDownloadQueue(filepath.Join(d, "queue.json"))
+	require.NoError(t, err)
+	_, _, err = q.Add(&SubtitlesDownloadParameters{FileID: 1}, filepath.Join(d, "1.srt"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = q.Run(ctx, c.Subtitles, &DownloadQueueRunParameters{NoWait: true})
+	var qe *QuotaError
+	require.ErrorAs(t, err, &qe)
+	assert.Equal(t, 2100, qe.ResetTimeUTC.Year())
+	assert.Equal(t, map[string]int{JobPending: 1}, q.Stats())
+}
@@ -0,0 +1,239 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const defaultQuotaSlotTTL = 5 * time.Minute
+
+// Coordinates the download quota of one account between the clients of several
+// processes on the same host. The state is kept in a file that is guarded by an
+// advisory lock. On the platforms without file locks, its methods fail with
+// ErrFileLockUnsupported.
+type QuotaCoordinator struct {
+	name string
+
+	// The time after which a slot that was neither committed nor released is
+	// considered abandoned, for example by a crashed process. Defaults to 5m.
+	SlotTTL time.Duration
+}
+
+type quotaState struct {
+	// The quota as last reported by the server.
+	Remaining    int       `json:"remaining"`
+	Allowed      int       `json:"allowed"`
+	ResetTimeUTC time.Time `json:"reset_time_utc"`
+	Known        bool      `json:"known"`
+
+	Slots []*quotaSlotState `json:"slots,omitempty"`
+}
+
+type quotaSlotState struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// Returned together with the download link when the download succeeded but the
+// quota coordinator or the download ledger could not record it. The slot of the
+// coordinator is dropped once its TTL passes.
+type QuotaCommitError struct {
+	Err error
+}
+
+func (e *QuotaCommitError) Error() string {
+	return fmt.Sprintf("rest: cannot record the download: %v", e.Err)
+}
+
+func (e *QuotaCommitError) Unwrap() error {
+	return e.Err
+}
+
+// A download slot reserved in the coordinator. It must be either committed
+// with the quota returned by the server or released.
+type QuotaSlot struct {
+	c    *QuotaCoordinator
+	id   string
+	done bool
+}
+
+var quotaSlotCounter int64
+
+// Creates a coordinator that keeps its state in the file.
+func NewQuotaCoordinator(name string) *QuotaCoordinator {
+	return &QuotaCoordinator{name: name}
+}
+
+// Atomically reserves a download slot. If the downloads that are left until
+// the reset are all reserved, returns a QuotaError without calling the server.
+func (c *QuotaCoordinator) Reserve() (*QuotaSlot, error) {
+	var slot *QuotaSlot
+	err := c.update(func (s *quotaState, now time.Time) error {
+		if s.Known && s.Remaining-len(s.Slots) <= 0 {
+			return &QuotaError{
+				ResponseError: ResponseError{
+					Message: "rest: download quota is exhausted by the clients of this host",
+				},
+				Quota: Quota{
+					Remaining: s.Remaining - len(s.Slots),
+					ResetTimeUTC: s.ResetTimeUTC,
+				},
+			}
+		}
+
+		n := atomic.AddInt64(&quotaSlotCounter, 1)
+		id := strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatInt(n, 10)
+		s.Slots = append(s.Slots, &quotaSlotState{
+			ID: id,
+			Expires: now.Add(c.slotTTL()),
+		})
+		slot = &QuotaSlot{c: c, id: id}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// Frees the slot and reconciles the state with the quota the server returned
+// for the download.
+func (s *QuotaSlot) Commit(q Quota) error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return s.c.update(func (st *quotaState, now time.Time) error {
+		st.removeSlot(s.id)
+		st.reconcile(q)
+		return nil
+	})
+}
+
+// Frees the slot without a download.
+func (s *QuotaSlot) Release() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return s.c.update(func (st *quotaState, now time.Time) error {
+		st.removeSlot(s.id)
+		return nil
+	})
+}
+
+// Reconciles the state with the quota returned by the server outside of a
+// slot, for example with the one of a QuotaError.
+func (c *QuotaCoordinator) Reconcile(q Quota) error {
+	return c.update(func (s *quotaState, now time.Time) error {
+		s.reconcile(q)
+		return nil
+	})
+}
+
+// Returns the number of downloads that are left until the reset and are not
+// reserved, and reports whether it is known.
+func (c *QuotaCoordinator) Available() (int, bool, error) {
+	var n int
+	var known bool
+	err := c.update(func (s *quotaState, now time.Time) error {
+		n = s.Remaining - len(s.Slots)
+		known = s.Known
+		return nil
+	})
+	return n, known, err
+}
+
+func (s *quotaState) reconcile(q Quota) {
+	if q.ResetTimeUTC.IsZero() {
+		return
+	}
+	s.Remaining = q.Remaining
+	if s.Remaining < 0 {
+		s.Remaining = 0
+	}
+	s.Allowed = q.Remaining + q.Requests
+	s.ResetTimeUTC = q.ResetTimeUTC
+	s.Known = true
+}
+
+func (s *quotaState) removeSlot(id string) {
+	for i, sl := range s.Slots {
+		if sl.ID == id {
+			s.Slots = append(s.Slots[:i], s.Slots[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *QuotaCoordinator) slotTTL() time.Duration {
+	if c.SlotTTL > 0 {
+		return c.SlotTTL
+	}
+	return defaultQuotaSlotTTL
+}
+
+// Reads the state under the lock, drops the abandoned slots, resets the quota
+// if its reset time has passed, lets the function change the state and writes
+// it back. The lock is held on a separate file, so the state can be replaced
+// atomically and a crash never leaves it half written.
+func (c *QuotaCoordinator) update(fn func (*quotaState, time.Time) error) error {
+	f, err := os.OpenFile(c.name+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = lockFile(f)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	data, err := os.ReadFile(c.name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var s quotaState
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return fmt.Errorf("rest: cannot read the quota state %q: %w", c.name, err)
+		}
+	}
+
+	now := time.Now().UTC()
+
+	slots := s.Slots[:0]
+	for _, sl := range s.Slots {
+		if sl.Expires.After(now) {
+			slots = append(slots, sl)
+		}
+	}
+	s.Slots = slots
+
+	if s.Known && !now.Before(s.ResetTimeUTC) {
+		// The server is the source of truth for the new period, so the state is
+		// unknown until the next download reports it.
+		s.Remaining = s.Allowed
+		s.Known = false
+	}
+
+	err = fn(&s, now)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.name, data, 0644)
+}
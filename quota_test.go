@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaCoordinatorReserve_ReservesSlotsAtomically(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "quota.json")
+	c0 := NewQuotaCoordinator(n)
+	c1 := NewQuotaCoordinator(n)
+
+	err := c0.Reconcile(Quota{
+		Remaining: 5,
+		Requests: 15,
+		ResetTimeUTC: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var slots []*QuotaSlot
+	var errs []error
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		c := c0
+		if i % 2 == 1 {
+			c = c1
+		}
+		go func () {
+			defer wg.Done()
+			s, err := c.Reserve()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				slots = append(slots, s)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, slots, 5)
+	require.Len(t, errs, 3)
+	var qe *QuotaError
+	assert.ErrorAs(t, errs[0], &qe)
+
+	a, known, err := c1.Available()
+	require.NoError(t, err)
+	assert.True(t, known)
+	assert.Equal(t, 0, a)
+
+	err = slots[0].Release()
+	require.NoError(t, err)
+	err = slots[1].Commit(Quota{Remaining: 4, Requests: 16, ResetTimeUTC: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	a, _, err = c0.Available()
+	require.NoError(t, err)
+	assert.Equal(t, 1, a)
+}
+
+func TestQuotaCoordinatorReserve_DropsAbandonedSlotsAndResets(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "quota.json")
+	c := NewQuotaCoordinator(n)
+	c.SlotTTL = time.Millisecond
+
+	err := c.Reconcile(Quota{Remaining: 1, Requests: 19, ResetTimeUTC: time.Now().Add(50 * time.Millisecond)})
+	require.NoError(t, err)
+
+	_, err = c.Reserve()
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = c.Reserve()
+	require.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	a, known, err := c.Available()
+	require.NoError(t, err)
+	assert.False(t, known)
+	assert.Equal(t, 20, a)
+}
+
+func TestSubtitlesServiceDownload_ReconcilesTheQuotaCoordinator(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	reset := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"link": "x", "remaining": 1, "requests": 9, "reset_time_utc": %q}`, reset)
+	})
+
+	client.QuotaCoordinator = NewQuotaCoordinator(filepath.Join(t.TempDir(), "quota.json"))
+
+	ctx := context.Background()
+	p := &SubtitlesDownloadParameters{FileID: 1}
+	_, _, err := client.Subtitles.Download(ctx, p)
+	require.NoError(t, err)
+	_, _, err = client.Subtitles.Download(ctx, p)
+	require.NoError(t, err)
+
+	a, _, err := client.QuotaCoordinator.Available()
+	require.NoError(t, err)
+	assert.Equal(t, 1, a)
+}
+
+func TestSubtitlesServiceDownload_ReturnsTheLinkIfTheCommitFails(t *testing.T) {
+	client, mux, teardown := setup()
+	defer teardown()
+
+	n := filepath.Join(t.TempDir(), "quota.json")
+	reset := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		// Makes the state unreadable once the slot is reserved.
+		require.NoError(t, os.Remove(n))
+		require.NoError(t, os.Mkdir(n, 0755))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"link": "x", "remaining": 1, "requests": 9, "reset_time_utc": %q}`, reset)
+	})
+
+	client.QuotaCoordinator = NewQuotaCoordinator(n)
+
+	d, _, err := client.Subtitles.Download(context.Background(), &SubtitlesDownloadParameters{FileID: 1})
+	var ce *QuotaCommitError
+	assert.ErrorAs(t, err, &ce)
+	require.NotNil(t, d)
+	assert.Equal(t, "x", *d.Link)
+}
+
+func TestQuotaCoordinator_ReplacesTheStateAtomically(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "quota.json")
+	c := NewQuotaCoordinator(n)
+
+	_, err := c.Reserve()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(filepath.Dir(n))
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"quota.json", "quota.json.lock"}, names)
+
+	data, err := os.ReadFile(n)
+	require.NoError(t, err)
+	assert.True(t, json.Valid(data))
+}
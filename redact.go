@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// The headers whose values are never recorded.
+var redactedHeaders = []string{
+	apiKeyHeader,
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// The JSON fields whose values are never recorded, such as the password of the
+// credentials and the token of the login.
+var redactedFields = map[string]bool{
+	"password": true,
+	"token":    true,
+}
+
+// Returns a copy of the headers with the API key, the bearer token and the
+// cookies redacted.
+func RedactHeaders(h http.Header) http.Header {
+	c := h.Clone()
+	for _, k := range redactedHeaders {
+		if c.Get(k) != "" {
+			c.Set(k, redacted)
+		}
+	}
+	return c
+}
+
+// Redacts the secret fields of a JSON body and truncates it to max bytes. A
+// body that is not JSON is returned as it is, unless it claims to be JSON, in
+// which case it is omitted, since it cannot be redacted.
+func RedactBody(data []byte, h http.Header, max int) string {
+	var v interface {}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		if strings.Contains(h.Get("Content-Type"), "application/json") {
+			return "[OMITTED]"
+		}
+		return truncateBody(string(data), max)
+	}
+
+	v = redactValue(v)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "[OMITTED]"
+	}
+	return truncateBody(string(out), max)
+}
+
+func redactValue(v interface {}) interface {} {
+	switch v := v.(type) {
+	case map[string]interface {}:
+		for k, f := range v {
+			if redactedFields[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(f)
+			}
+		}
+		return v
+	case []interface {}:
+		for i, f := range v {
+			v[i] = redactValue(f)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func truncateBody(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "...[TRUNCATED]"
+}
+
+// Reports whether the body is JSON or text, which RedactBody can redact, so it
+// can be logged or recorded as text.
+func IsTextBody(h http.Header) bool {
+	t := h.Get("Content-Type")
+	return strings.Contains(t, "application/json") || strings.HasPrefix(t, "text/")
+}
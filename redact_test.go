@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHeaders_RedactsTheSecrets(t *testing.T) {
+	h := http.Header{}
+	h.Set(apiKeyHeader, "key")
+	h.Set("Authorization", "Bearer token")
+	h.Set("Accept", "application/json")
+
+	r := RedactHeaders(h)
+	assert.Equal(t, redacted, r.Get(apiKeyHeader))
+	assert.Equal(t, redacted, r.Get("Authorization"))
+	assert.Equal(t, "application/json", r.Get("Accept"))
+	assert.Equal(t, "key", h.Get(apiKeyHeader))
+}
+
+func TestRedactBody_RedactsAndTruncates(t *testing.T) {
+	s := RedactBody([]byte(`{"user": {"password": "p"}, "token": "t"}`), http.Header{"Content-Type": {"application/json"}}, 100)
+	assert.Equal(t, `{"token":"[REDACTED]","user":{"password":"[REDACTED]"}}`, s)
+
+	s = RedactBody([]byte("hello world"), http.Header{"Content-Type": {"text/plain"}}, 5)
+	assert.Equal(t, "hello...[TRUNCATED]", s)
+
+	s = RedactBody([]byte("{not json"), http.Header{"Content-Type": {"application/json"}}, 5)
+	assert.Equal(t, "[OMITTED]", s)
+}
+
+func TestIsTextBody_AcceptsJSONAndText(t *testing.T) {
+	assert.True(t, IsTextBody(http.Header{"Content-Type": {"application/json; charset=utf-8"}}))
+	assert.True(t, IsTextBody(http.Header{"Content-Type": {"text/plain"}}))
+	assert.False(t, IsTextBody(http.Header{"Content-Type": {"application/octet-stream"}}))
+	assert.False(t, IsTextBody(http.Header{}))
+}
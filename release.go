@@ -0,0 +1,434 @@
+package rest
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Describes a release parsed from a release or file name, such as
+// Movie.2019.1080p.BluRay.x264-GROUP.
+type Release struct {
+	Title      string
+	Year       int
+	Season     int
+	Episode    int
+	Source     string
+	Resolution string
+	Codec      string
+	Group      string
+	Edition    string
+	Proper     bool
+	Repack     bool
+}
+
+var releaseSources = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"bluray", regexp.MustCompile(`^(blu-?ray|bd(rip|remux)?|br(rip)?|bdmv)$`)},
+	{"webdl", regexp.MustCompile(`^(web-?dl|web)$`)},
+	{"webrip", regexp.MustCompile(`^web-?rip$`)},
+	{"hdtv", regexp.MustCompile(`^(hdtv|pdtv|sdtv)$`)},
+	{"dvdrip", regexp.MustCompile(`^(dvd-?rip|dvd(5|9)?|dvdr)$`)},
+	{"hdrip", regexp.MustCompile(`^hd-?rip$`)},
+	{"cam", regexp.MustCompile(`^(cam|hdcam|ts|telesync|tc|telecine)$`)},
+}
+
+var releaseResolutions = map[string]string{
+	"2160p": "2160p",
+	"4k":    "2160p",
+	"uhd":   "2160p",
+	"1080p": "1080p",
+	"1080i": "1080p",
+	"720p":  "720p",
+	"576p":  "576p",
+	"480p":  "480p",
+}
+
+var releaseCodecs = map[string]string{
+	"x264": "h264",
+	"h264": "h264",
+	"avc":  "h264",
+	"x265": "h265",
+	"h265": "h265",
+	"hevc": "h265",
+	"xvid": "xvid",
+	"divx": "divx",
+	"av1":  "av1",
+	"vp9":  "vp9",
+}
+
+var releaseEditions = map[string]string{
+	"extended":   "extended",
+	"unrated":    "unrated",
+	"uncut":      "unrated",
+	"directors":  "directors",
+	"dc":         "directors",
+	"theatrical": "theatrical",
+	"remastered": "remastered",
+	"imax":       "imax",
+	"criterion":  "criterion",
+}
+
+var (
+	releaseSplitRe   = regexp.MustCompile(`[\s._\[\]()]+`)
+	releaseYearRe    = regexp.MustCompile(`^(19|20)\d\d$`)
+	releaseEpisodeRe = regexp.MustCompile(`^s(\d{1,2})e(\d{1,3})(e\d{1,3})?$`)
+	releaseCrossRe   = regexp.MustCompile(`^(\d{1,2})x(\d{1,3})$`)
+	releaseGroupRe   = regexp.MustCompile(`-([a-zA-Z0-9]+)$`)
+)
+
+var videoExtensions = map[string]bool{
+	".avi":  true,
+	".m2ts": true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".mpg":  true,
+	".mpeg": true,
+	".ogm":  true,
+	".ts":   true,
+	".webm": true,
+	".wmv":  true,
+}
+
+// Parses a release or file name. Fields that cannot be recognized are left
+// zero.
+func ParseRelease(s string) *Release {
+	r := &Release{}
+
+	s = filepath.Base(strings.TrimSpace(s))
+	ext := strings.ToLower(filepath.Ext(s))
+	if videoExtensions[ext] || ext == ".srt" || ext == ".sub" {
+		s = strings.TrimSuffix(s, filepath.Ext(s))
+	}
+
+	tokens := releaseSplitRe.Split(s, -1)
+	last := strings.ToLower(tokens[len(tokens)-1])
+
+	// A trailing WEB-DL or Blu-ray is a source rather than a group.
+	m := releaseGroupRe.FindStringSubmatch(s)
+	if m != nil && releaseSource(last) == "" {
+		r.Group = strings.ToLower(m[1])
+		s = strings.TrimSuffix(s, m[0])
+		tokens = releaseSplitRe.Split(s, -1)
+	}
+
+	var title []string
+	inTitle := true
+
+	for i := 0; i < len(tokens); i += 1 {
+		t := strings.ToLower(tokens[i])
+		if t == "" {
+			continue
+		}
+
+		// A keyword that leads the name, as in DC.League.of.Super-Pets, is a
+		// part of the title, so the edition, the source and the codec are
+		// only recognized once the title has begun.
+		started := len(title) > 0 || !inTitle
+
+		known := true
+		switch {
+		case releaseYearRe.MatchString(t) && (len(title) > 0 || !inTitle):
+			r.Year, _ = strconv.Atoi(t)
+
+		case releaseEpisodeRe.MatchString(t):
+			m := releaseEpisodeRe.FindStringSubmatch(t)
+			r.Season, _ = strconv.Atoi(m[1])
+			r.Episode, _ = strconv.Atoi(m[2])
+
+		case releaseCrossRe.MatchString(t):
+			m := releaseCrossRe.FindStringSubmatch(t)
+			r.Season, _ = strconv.Atoi(m[1])
+			r.Episode, _ = strconv.Atoi(m[2])
+
+		case releaseResolutions[t] != "":
+			r.Resolution = releaseResolutions[t]
+
+		case !started:
+			known = false
+
+		case releaseCodecs[t] != "":
+			r.Codec = releaseCodecs[t]
+
+		case t == "web" && i+1 < len(tokens) && strings.EqualFold(tokens[i+1], "dl"):
+			r.Source = "webdl"
+			i += 1
+
+		case t == "directors" && i+1 < len(tokens) && strings.EqualFold(tokens[i+1], "cut"):
+			r.Edition = "directors"
+			i += 1
+
+		case releaseEditions[t] != "":
+			r.Edition = releaseEditions[t]
+
+		case t == "proper":
+			r.Proper = true
+
+		case t == "repack":
+			r.Repack = true
+
+		default:
+			src := releaseSource(t)
+			if src != "" {
+				r.Source = src
+			} else {
+				known = false
+			}
+		}
+
+		if known {
+			inTitle = false
+			continue
+		}
+		if inTitle {
+			title = append(title, t)
+		}
+	}
+
+	r.Title = strings.Join(title, " ")
+
+	return r
+}
+
+func releaseSource(t string) string {
+	for _, s := range releaseSources {
+		if s.re.MatchString(t) {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// Compares the release with another one and returns how well they match, from
+// 0 to 1. Fields that are unknown in either release neither add nor subtract.
+func (r *Release) Match(o *Release) float64 {
+	var score, total float64
+
+	add := func (w float64, a, b string) {
+		if a == "" || b == "" {
+			return
+		}
+		total += w
+		if a == b {
+			score += w
+		}
+	}
+
+	add(3, r.Group, o.Group)
+	add(3, r.Source, o.Source)
+	add(1.5, r.Resolution, o.Resolution)
+	add(1, r.Codec, o.Codec)
+	add(1, r.Edition, o.Edition)
+
+	if r.Year != 0 && o.Year != 0 {
+		total += 1
+		if r.Year == o.Year {
+			score += 1
+		}
+	}
+	if r.Season != 0 && o.Season != 0 {
+		total += 2
+		if r.Season == o.Season && r.Episode == o.Episode {
+			score += 2
+		}
+	}
+	if r.Title != "" && o.Title != "" {
+		total += 1
+		if r.Title == o.Title {
+			score += 1
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	m := score / total
+	if r.Proper != o.Proper || r.Repack != o.Repack {
+		// A proper or a repack is usually re-encoded, so the timings may differ
+		// from the original release.
+		m *= 0.9
+	}
+
+	return m
+}
+
+func (r *Release) String() string {
+	var p []string
+	if r.Title != "" {
+		p = append(p, r.Title)
+	}
+	if r.Year != 0 {
+		p = append(p, strconv.Itoa(r.Year))
+	}
+	if r.Season != 0 {
+		p = append(p, fmt.Sprintf("s%02de%02d", r.Season, r.Episode))
+	}
+	for _, v := range []string{r.Edition, r.Resolution, r.Source, r.Codec} {
+		if v != "" {
+			p = append(p, v)
+		}
+	}
+	if r.Proper {
+		p = append(p, "proper")
+	}
+	if r.Repack {
+		p = append(p, "repack")
+	}
+	s := strings.Join(p, ".")
+	if r.Group != "" {
+		s += "-" + r.Group
+	}
+	return s
+}
+
+type RankWeights struct {
+	Release   float64
+	Ratings   float64
+	Votes     float64
+	Downloads float64
+	Trusted   float64
+	Moviehash float64
+}
+
+var defaultRankWeights = RankWeights{
+	Release: 6,
+	Ratings: 1.5,
+	Votes: 0.5,
+	Downloads: 1,
+	Trusted: 1,
+	Moviehash: 2,
+}
+
+type RankParameters struct {
+	// The name or path of the local video file to compare the releases with.
+	FileName string
+
+	// Defaults to the weights that favor the release match.
+	Weights *RankWeights
+}
+
+type RankedSubtitle struct {
+	Entity *SubtitleEntity
+
+	// The file of the subtitle whose name matched the video file the best, or
+	// the first one.
+	File *File
+
+	Release      *Release
+	ReleaseMatch float64
+	Score        float64
+	Reasons      []string
+}
+
+// Ranks the subtitles by how well their releases match the local video file,
+// combined with the ratings, votes, download count, uploader trust and whether
+// they match the moviehash of the file. The best match comes first.
+func RankSubtitles(s []*SubtitleEntity, p *RankParameters) []*RankedSubtitle {
+	if p == nil {
+		p = &RankParameters{}
+	}
+	w := defaultRankWeights
+	if p.Weights != nil {
+		w = *p.Weights
+	}
+
+	var video *Release
+	if p.FileName != "" {
+		video = ParseRelease(p.FileName)
+	}
+
+	var maxDownloads, maxVotes int
+	for _, e := range s {
+		if e == nil || e.Attributes == nil {
+			continue
+		}
+		a := e.Attributes
+		if a.DownloadCount != nil && *a.DownloadCount > maxDownloads {
+			maxDownloads = *a.DownloadCount
+		}
+		if a.Votes != nil && *a.Votes > maxVotes {
+			maxVotes = *a.Votes
+		}
+	}
+
+	var r []*RankedSubtitle
+	for _, e := range s {
+		if e == nil || e.Attributes == nil {
+			continue
+		}
+		r = append(r, rankSubtitle(e, video, &w, maxDownloads, maxVotes))
+	}
+
+	sort.SliceStable(r, func (i, j int) bool {
+		return r[i].Score > r[j].Score
+	})
+
+	return r
+}
+
+func rankSubtitle(e *SubtitleEntity, video *Release, w *RankWeights, maxDownloads, maxVotes int) *RankedSubtitle {
+	a := e.Attributes
+	r := &RankedSubtitle{Entity: e}
+
+	if len(a.Files) > 0 {
+		r.File = a.Files[0]
+	}
+
+	if video != nil {
+		if a.Release != nil {
+			r.Release = ParseRelease(*a.Release)
+			r.ReleaseMatch = video.Match(r.Release)
+		}
+		for _, f := range a.Files {
+			if f == nil || f.FileName == nil {
+				continue
+			}
+			m := video.Match(ParseRelease(*f.FileName))
+			if m > r.ReleaseMatch {
+				r.ReleaseMatch = m
+				r.File = f
+			}
+		}
+		r.Score += w.Release * r.ReleaseMatch
+		r.Reasons = append(r.Reasons, fmt.Sprintf("release match %.0f%%", r.ReleaseMatch*100))
+	}
+
+	if a.Ratings != nil && *a.Ratings > 0 {
+		v := float64(*a.Ratings) / 10
+		r.Score += w.Ratings * v
+		r.Reasons = append(r.Reasons, fmt.Sprintf("rated %.1f", *a.Ratings))
+	}
+
+	if a.Votes != nil && *a.Votes > 0 && maxVotes > 0 {
+		v := math.Log1p(float64(*a.Votes)) / math.Log1p(float64(maxVotes))
+		r.Score += w.Votes * v
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d votes", *a.Votes))
+	}
+
+	if a.DownloadCount != nil && *a.DownloadCount > 0 && maxDownloads > 0 {
+		v := math.Log1p(float64(*a.DownloadCount)) / math.Log1p(float64(maxDownloads))
+		r.Score += w.Downloads * v
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d downloads", *a.DownloadCount))
+	}
+
+	if a.FromTrusted != nil && *a.FromTrusted {
+		r.Score += w.Trusted
+		r.Reasons = append(r.Reasons, "from a trusted uploader")
+	}
+
+	if a.MoviehashMatch != nil && *a.MoviehashMatch {
+		r.Score += w.Moviehash
+		r.Reasons = append(r.Reasons, "matches the moviehash")
+	}
+
+	return r
+}
@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelease_ParsesTheRelease(t *testing.T) {
+	a := ParseRelease("Movie.Name.2019.Extended.1080p.BluRay.x264-GROUP")
+	e := &Release{
+		Title: "movie name",
+		Year: 2019,
+		Source: "bluray",
+		Resolution: "1080p",
+		Codec: "h264",
+		Group: "group",
+		Edition: "extended",
+	}
+	assert.Equal(t, e, a)
+
+	a = ParseRelease("/videos/Show Name S02E05 PROPER 720p WEB-DL HEVC-grp.mkv")
+	e = &Release{
+		Title: "show name",
+		Season: 2,
+		Episode: 5,
+		Source: "webdl",
+		Resolution: "720p",
+		Codec: "h265",
+		Group: "grp",
+		Proper: true,
+	}
+	assert.Equal(t, e, a)
+
+	a = ParseRelease("Movie (2001) Directors Cut REPACK WEB-DL")
+	e = &Release{
+		Title: "movie",
+		Year: 2001,
+		Source: "webdl",
+		Edition: "directors",
+		Repack: true,
+	}
+	assert.Equal(t, e, a)
+}
+
+func TestParseRelease_KeepsALeadingKeywordInTheTitle(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		e    *Release
+	}{
+		{"DC.League.of.Super-Pets.2022.1080p.WEB-DL.x264-GROUP", &Release{Title: "dc league of super-pets", Year: 2022, Resolution: "1080p", Source: "webdl", Codec: "h264", Group: "group"}},
+		{"Extended.Family.2020.720p.BluRay", &Release{Title: "extended family", Year: 2020, Resolution: "720p", Source: "bluray"}},
+		{"TS.Movie.2019.HDTV", &Release{Title: "ts movie", Year: 2019, Source: "hdtv"}},
+		{"Proper.Movie.2019.Extended", &Release{Title: "proper movie", Year: 2019, Edition: "extended"}},
+	} {
+		assert.Equal(t, tc.e, ParseRelease(tc.name), tc.name)
+	}
+}
+
+func TestReleaseString_ReturnsString(t *testing.T) {
+	a := ParseRelease("Movie.2019.1080p.BluRay.x264.PROPER-GROUP")
+	assert.Equal(t, "movie.2019.1080p.bluray.h264.proper-group", a.String())
+}
+
+func TestReleaseMatch_ComparesReleases(t *testing.T) {
+	v := ParseRelease("Movie.2019.1080p.BluRay.x264-GROUP.mkv")
+
+	a := v.Match(ParseRelease("Movie.2019.1080p.BluRay.x264-GROUP"))
+	assert.Equal(t, 1.0, a)
+
+	b := v.Match(ParseRelease("Movie.2019.720p.BluRay.x264-OTHER"))
+	c := v.Match(ParseRelease("Movie.2019.1080p.WEB-DL.x264-OTHER"))
+	assert.Less(t, b, a)
+	assert.Less(t, c, b)
+
+	d := v.Match(ParseRelease("Movie.2019.1080p.BluRay.x264.REPACK-GROUP"))
+	assert.Less(t, d, a)
+
+	assert.Equal(t, 0.0, v.Match(&Release{}))
+}
+
+func TestRankSubtitles_RanksByMatchAndCommunity(t *testing.T) {
+	newEntity := func (id int64, release string, ratings float32, downloads int, trusted bool) *SubtitleEntity {
+		return &SubtitleEntity{
+			ID: AllocateID(id),
+			Attributes: &Subtitle{
+				Release: AllocateString(release),
+				Ratings: AllocateFloat32(ratings),
+				DownloadCount: AllocateInt(downloads),
+				FromTrusted: AllocateBool(trusted),
+				Files: []*File{
+					{FileID: AllocateID(id * 10)},
+				},
+			},
+		}
+	}
+
+	s := []*SubtitleEntity{
+		newEntity(1, "Movie.2019.720p.WEBRip.x264-AAA", 9, 10000, true),
+		newEntity(2, "Movie.2019.1080p.BluRay.x264-GROUP", 6, 100, false),
+		newEntity(3, "Movie.2019.1080p.BluRay.x264-OTHER", 8, 5000, false),
+		nil,
+		{},
+	}
+
+	a := RankSubtitles(s, &RankParameters{
+		FileName: "Movie.2019.1080p.BluRay.x264-GROUP.mkv",
+	})
+	assert.Len(t, a, 3)
+	assert.Equal(t, ID(2), *a[0].Entity.ID)
+	assert.Equal(t, ID(3), *a[1].Entity.ID)
+	assert.Equal(t, ID(1), *a[2].Entity.ID)
+	assert.Equal(t, ID(20), *a[0].File.FileID)
+	assert.Equal(t, 1.0, a[0].ReleaseMatch)
+	assert.Contains(t, a[0].Reasons, "release match 100%")
+	assert.Contains(t, a[2].Reasons, "from a trusted uploader")
+
+	a = RankSubtitles(s, nil)
+	assert.Equal(t, ID(1), *a[0].Entity.ID)
+}
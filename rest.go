@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -42,10 +44,47 @@ const (
 type Client struct {
 	client *http.Client
 
+	// The HTTP client before WithAuthToken wrapped its transport, which fetches
+	// the download links without the credentials of the API.
+	plain *http.Client
+
 	APIKey    string
 	UserAgent string
 	BaseURL   *url.URL
 
+	// Coordinates the download quota with the clients of other processes that
+	// use the same account. Downloads are not coordinated if it is nil.
+	QuotaCoordinator *QuotaCoordinator
+
+	// Serves the repeated downloads of DownloadFile without spending the quota.
+	DownloadCache *DownloadCache
+
+	// Records every download and refuses the ones that would dip into its
+	// reserve. Downloads are not recorded if it is nil.
+	DownloadLedger *DownloadLedger
+
+	// Rotates the API keys of the pool instead of using APIKey.
+	APIKeyPool *APIKeyPool
+
+	// Receives the spans and metrics of the requests. Nothing is reported if
+	// it is nil.
+	Instrumentation Instrumentation
+
+	// Fails the requests fast while the server is down. The requests are always
+	// sent if it is nil.
+	CircuitBreaker *CircuitBreaker
+
+	// Shares one round-trip between identical concurrent GET requests. Every
+	// request makes its own round-trip if it is nil.
+	Coalescer *Coalescer
+
+	// The token set by WithAuthToken, which tells the requests of different
+	// users apart.
+	authToken string
+
+	middleware     []Middleware
+	linkMiddleware []Middleware
+
 	internal service
 
 	Auth      *AuthService
@@ -74,6 +113,8 @@ func NewClient(client *http.Client) *Client {
 		}
 	}
 
+	c.plain = c.client
+
 	c.APIKey = defaultAPIKey
 	c.UserAgent = defaultUserAgent
 	c.BaseURL, _ = url.Parse(defaultBaseURL)
@@ -97,9 +138,15 @@ func (c *Client) Client() *http.Client {
 
 func (c *Client) WithAuthToken(t string) *Client {
 	cp := c.copy()
+	cp.authToken = t
 	tr := cp.client.Transport
 	cp.client.Transport = roundTripperFunc(
 		func (req *http.Request) (*http.Response, error) {
+			// A token set for a single call through the context takes precedence
+			// over the one of the client.
+			if _, ok := req.Context().Value(authTokenContextKey).(string); ok {
+				return tr.RoundTrip(req)
+			}
 			req = req.Clone(req.Context())
 			req.Header.Set("Authorization", "Bearer " + t)
 			return tr.RoundTrip(req)
@@ -110,6 +157,7 @@ func (c *Client) WithAuthToken(t string) *Client {
 
 func (c *Client) copy() *Client {
 	cp := NewClient(c.client)
+	cp.plain = c.plain
 
 	if c.APIKey != "" {
 		cp.APIKey = c.APIKey
@@ -120,6 +168,16 @@ func (c *Client) copy() *Client {
 	if c.BaseURL != nil {
 		cp.BaseURL = c.BaseURL
 	}
+	cp.QuotaCoordinator = c.QuotaCoordinator
+	cp.DownloadCache = c.DownloadCache
+	cp.DownloadLedger = c.DownloadLedger
+	cp.APIKeyPool = c.APIKeyPool
+	cp.Instrumentation = c.Instrumentation
+	cp.CircuitBreaker = c.CircuitBreaker
+	cp.Coalescer = c.Coalescer
+	cp.authToken = c.authToken
+	cp.middleware = append([]Middleware(nil), c.middleware...)
+	cp.linkMiddleware = append([]Middleware(nil), c.linkMiddleware...)
 
 	return cp
 }
@@ -209,7 +267,10 @@ type Rate struct {
 	Reset     int
 }
 
-func newResponse(r *http.Response) *Response {
+// Parses the response. A JSON body of a successful response is decoded into
+// the decode target of Do, if there is one, in the same pass as the pagination
+// and the quota. The body is left readable for the callers of BareDo.
+func newResponse(r *http.Response, dt *decodeTarget) *Response {
 	res := &Response{Response: r}
 
 	var p Pagination
@@ -217,18 +278,15 @@ func newResponse(r *http.Response) *Response {
 
 	t := r.Header.Get("Content-Type")
 	if t != "" && strings.Contains(t, "application/json") {
-		data, err := io.ReadAll(r.Body)
-		if err == nil && data != nil {
-			err = json.Unmarshal(data, &p)
-			if err != nil {
-				p = Pagination{}
-			}
-			err = json.Unmarshal(data, &q)
-			if err != nil {
-				q = Quota{}
-			}
+		var data []byte
+		if dt != nil && 200 <= r.StatusCode && r.StatusCode <= 299 {
+			data, dt.err = decodeResponse(r.Body, dt.v, &p, &q)
+			dt.res = res
+		} else {
+			data, _ = decodeResponse(r.Body, nil, &p, &q)
 		}
-		r.Body = io.NopCloser(bytes.NewBuffer(data))
+		r.Body.Close()
+		r.Body = newBufferedBody(data)
 	}
 
 	res.Pagination = p
@@ -260,7 +318,14 @@ func parseRate(res *http.Response) Rate {
 }
 
 func (c *Client) Do(ctx context.Context, req *http.Request, v interface {}) (*Response, error) {
-	res, err := c.BareDo(ctx, req)
+	var dt *decodeTarget
+	switch v.(type) {
+	case nil, io.Writer:
+	default:
+		dt = &decodeTarget{v: v}
+	}
+
+	res, err := c.send(ctx, req, dt)
 	if err != nil {
 		return res, err
 	}
@@ -271,6 +336,11 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface {}) (*Re
 	case io.Writer:
 		_, err = io.Copy(v, res.Body)
 	default:
+		if dt != nil && dt.res == res {
+			// The body has been decoded along with the pagination and the quota.
+			err = dt.err
+			break
+		}
 		d := json.NewDecoder(res.Body)
 		dErr := d.Decode(v)
 		if dErr == io.EOF {
@@ -286,8 +356,35 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface {}) (*Re
 }
 
 func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, error) {
+	return c.send(ctx, req, nil)
+}
+
+// Sends the request like BareDo does, and decodes a successful response into
+// the decode target, if there is one, as it is read.
+func (c *Client) send(ctx context.Context, req *http.Request, dt *decodeTarget) (*Response, error) {
 	req = req.WithContext(ctx)
+	req = applyContextCredentials(ctx, req)
+
+	// Every caller gets its own span, including the ones that share the
+	// round-trip of an identical request in flight.
+	if c.Coalescer != nil {
+		k := c.coalesceKey(req)
+		if k != "" {
+			return c.instrument(ctx, req, func (ctx context.Context, req *http.Request) (*Response, bool, error) {
+				shared := true
+				res, err := c.Coalescer.do(ctx, k, func () (*Response, error) {
+					shared = false
+					return c.handler(dt)(ctx, req)
+				})
+				return res, shared, err
+			})
+		}
+	}
 
+	return c.instrumented(ctx, req, c.handler(dt))
+}
+
+func (c *Client) bareDo(ctx context.Context, req *http.Request, dt *decodeTarget) (*Response, error) {
 	r, err := c.client.Do(req)
 	if err != nil {
 		// If we got an error, and the context has been canceled, the context's
@@ -301,7 +398,7 @@ func (c *Client) BareDo(ctx context.Context, req *http.Request) (*Response, erro
 		return nil, err
 	}
 
-	res := newResponse(r)
+	res := newResponse(r, dt.pending())
 
 	err = CheckResponse(r)
 	if err != nil {
@@ -371,6 +468,61 @@ func (e *ErrorResponse) Error() string {
 	return e.ResponseError.Error()
 }
 
+// Finds the first error in the chain, or among the errors of an ErrorResponse,
+// that matches the target, and sets the target to it. The errors of an
+// ErrorResponse are not wrapped by it, so errors.As does not find them.
+func AsError(err error, target interface {}) bool {
+	if errors.As(err, target) {
+		return true
+	}
+	var er *ErrorResponse
+	if errors.As(err, &er) {
+		for _, e := range er.Errors {
+			if errors.As(e, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Finds the first error like AsError does, but skips the errors that the client
+// added for the headers that the request did not have, so only the errors that
+// the server reported are matched.
+func AsReportedError(err error, target interface {}) bool {
+	var er *ErrorResponse
+	if errors.As(err, &er) {
+		for _, e := range er.Errors {
+			if !isClientError(e) && errors.As(e, target) {
+				return true
+			}
+		}
+		return false
+	}
+	if !errors.As(err, target) {
+		return false
+	}
+	e, ok := reflect.ValueOf(target).Elem().Interface().(error)
+	return ok && !isClientError(e)
+}
+
+// Reports whether the error was added by CheckResponse for a header that the
+// request did not have, rather than reported by the server.
+func isClientError(err error) bool {
+	var m string
+	switch e := err.(type) {
+	case *APIKeyError:
+		m = e.Message
+	case *AuthTokenError:
+		m = e.Message
+	case *UserAgentError:
+		m = e.Message
+	default:
+		return false
+	}
+	return strings.HasPrefix(m, "rest: ")
+}
+
 type ResponseError struct {
 	Response *http.Response
 	Message  string
@@ -399,6 +551,12 @@ type internalError struct {
 }
 
 func CheckResponse(res *http.Response) error {
+	return checkResponse(res, true)
+}
+
+// Checks the response like CheckResponse does, but only adds the errors for the
+// headers that the request did not have if checkHeaders is set.
+func checkResponse(res *http.Response, checkHeaders bool) error {
 	if 200 <= res.StatusCode && res.StatusCode <= 299 {
 		return nil
 	}
@@ -416,7 +574,7 @@ func CheckResponse(res *http.Response) error {
 		messages = append(messages, v)
 	}
 
-	data, err := io.ReadAll(res.Body)
+	data, err := readBody(res.Body)
 	if err == nil && data != nil {
 		t := er.Response.Header.Get("Content-Type")
 		if t != "" {
@@ -511,7 +669,12 @@ func CheckResponse(res *http.Response) error {
 			er.Errors = append(er.Errors, err)
 		}
 	}
-	res.Body = io.NopCloser(bytes.NewBuffer(data))
+	res.Body = newBufferedBody(data)
+
+	if !checkHeaders {
+		er.Message = strings.Join(messages, "; ")
+		return er
+	}
 
 	v = er.Response.Request.Header.Get(apiKeyHeader)
 	if v == "" {
@@ -1321,3 +1321,37 @@ func toBody(s string) io.ReadCloser {
 	r := strings.NewReader(s)
 	return io.NopCloser(r)
 }
+
+func TestAsError_FindsTheErrorInTheErrorResponse(t *testing.T) {
+	_, r := testResponseError()
+	q := &QuotaError{ResponseError: *r}
+	var err error = &ErrorResponse{
+		ResponseError: *r,
+		Errors: []error{(*ResponseError)(r), q},
+	}
+
+	var qa *QuotaError
+	assert.True(t, AsError(err, &qa))
+	assert.Equal(t, q, qa)
+
+	var fa *FileError
+	assert.False(t, AsError(err, &fa))
+
+	err = fmt.Errorf("wrapped: %w", (*FileError)(r))
+	assert.True(t, AsError(err, &fa))
+}
+
+func TestAsReportedError_SkipsTheErrorsOfTheClient(t *testing.T) {
+	var err error = &ErrorResponse{
+		Errors: []error{&AuthTokenError{Message: "rest: authorization header is empty"}},
+	}
+
+	var ae *AuthTokenError
+	assert.True(t, AsError(err, &ae))
+	assert.False(t, AsReportedError(err, &ae))
+
+	r := &AuthTokenError{Message: "Invalid token"}
+	err = &ErrorResponse{Errors: []error{r}}
+	assert.True(t, AsReportedError(err, &ae))
+	assert.Equal(t, r, ae)
+}
@@ -0,0 +1,358 @@
+package rest
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var subtitleExtensions = map[string]bool{
+	".ass": true,
+	".smi": true,
+	".srt": true,
+	".ssa": true,
+	".sub": true,
+	".vtt": true,
+}
+
+// The ISO 639-2 codes that media servers accept in sidecar names, mapped to the
+// ISO 639-1 codes that OpenSubtitles uses.
+var sidecarLanguages = map[string]string{
+	"ara": "ar",
+	"chi": "zh",
+	"cze": "cs",
+	"dan": "da",
+	"dut": "nl",
+	"eng": "en",
+	"fin": "fi",
+	"fre": "fr",
+	"ger": "de",
+	"gre": "el",
+	"heb": "he",
+	"hun": "hu",
+	"ita": "it",
+	"jpn": "ja",
+	"kor": "ko",
+	"nor": "no",
+	"pol": "pl",
+	"por": "pt",
+	"rum": "ro",
+	"rus": "ru",
+	"spa": "es",
+	"swe": "sv",
+	"tur": "tr",
+	"ukr": "uk",
+}
+
+type ScanParameters struct {
+	// The directories to walk.
+	Roots []string
+
+	// The languages every video should have a subtitle in.
+	Languages []string
+
+	// Skips the search for the missing languages and only reports the local
+	// state.
+	Offline bool
+
+	// The least time to wait between two searches, on top of the rate limit
+	// reported by the server.
+	Interval time.Duration
+}
+
+type LibraryReport struct {
+	Videos []*VideoReport `json:"videos"`
+
+	// The number of videos that miss at least one language.
+	Incomplete int `json:"incomplete"`
+}
+
+type VideoReport struct {
+	Path      string     `json:"path"`
+	Moviehash string     `json:"moviehash,omitempty"`
+	Sidecars  []*Sidecar `json:"sidecars,omitempty"`
+	Missing   []string   `json:"missing,omitempty"`
+
+	// The number of subtitles found on the server for each missing language.
+	Available map[string]int `json:"available,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// A subtitle file that lies next to a video, such as Video.en.forced.srt.
+type Sidecar struct {
+	Path            string `json:"path"`
+	Language        string `json:"language,omitempty"`
+	Forced          bool   `json:"forced,omitempty"`
+	HearingImpaired bool   `json:"hearing_impaired,omitempty"`
+}
+
+// Walks the directories and reports the video files, their sidecar subtitles
+// and the languages they miss, without any requests.
+func ScanLibrary(p *ScanParameters) (*LibraryReport, error) {
+	if p == nil {
+		p = &ScanParameters{}
+	}
+
+	r := &LibraryReport{
+		Videos: []*VideoReport{},
+	}
+
+	for _, root := range p.Roots {
+		var videos []string
+		subs := map[string][]string{}
+
+		err := filepath.WalkDir(root, func (path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			switch {
+			case videoExtensions[ext]:
+				videos = append(videos, path)
+			case subtitleExtensions[ext]:
+				dir := filepath.Dir(path)
+				subs[dir] = append(subs[dir], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range videos {
+			vr := &VideoReport{Path: v}
+			for _, s := range subs[filepath.Dir(v)] {
+				sc := ParseSidecar(v, s)
+				if sc != nil {
+					vr.Sidecars = append(vr.Sidecars, sc)
+				}
+			}
+			vr.Missing = missingLanguages(vr.Sidecars, p.Languages)
+			if len(vr.Missing) > 0 {
+				r.Incomplete += 1
+			}
+			r.Videos = append(r.Videos, vr)
+		}
+	}
+
+	return r, nil
+}
+
+// Parses the name of a subtitle that lies next to the video. Returns nil if the
+// subtitle does not belong to the video, including when its name has a tag that
+// is not a language, a kind or a number, such as Movie.Part.2.en.srt next to
+// Movie.mkv.
+func ParseSidecar(video, sub string) *Sidecar {
+	if filepath.Dir(video) != filepath.Dir(sub) {
+		return nil
+	}
+
+	vb := strings.TrimSuffix(filepath.Base(video), filepath.Ext(video))
+	sb := strings.TrimSuffix(filepath.Base(sub), filepath.Ext(sub))
+	if sb != vb && !strings.HasPrefix(sb, vb+".") {
+		return nil
+	}
+
+	s := &Sidecar{Path: sub}
+
+	tags := strings.Split(strings.TrimPrefix(sb, vb), ".")
+	for _, t := range tags {
+		t = strings.ToLower(t)
+		switch {
+		case t == "":
+		case t == "forced" || t == "foreign":
+			s.Forced = true
+		case t == "sdh" || t == "hi" || t == "cc":
+			s.HearingImpaired = true
+		case isNumber(t):
+			// Tells several subtitles of one language apart.
+		case !isLanguageCode(t):
+			return nil
+		case s.Language == "":
+			s.Language = normalizeLanguage(t)
+		}
+	}
+
+	return s
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2}([-_]([a-z]{2}|[a-z]{4}|[0-9]{3}))?$`)
+
+// Reports whether the tag is an ISO 639-1 code, with an optional region or
+// script, or one of the ISO 639-2 codes of sidecarLanguages.
+func isLanguageCode(t string) bool {
+	_, ok := sidecarLanguages[t]
+	return ok || languageCodePattern.MatchString(t)
+}
+
+func normalizeLanguage(l string) string {
+	l = strings.ToLower(strings.ReplaceAll(l, "_", "-"))
+	m, ok := sidecarLanguages[l]
+	if ok {
+		return m
+	}
+	return l
+}
+
+func missingLanguages(s []*Sidecar, languages []string) []string {
+	var m []string
+	for _, l := range languages {
+		nl := normalizeLanguage(l)
+		found := false
+		for _, sc := range s {
+			if sc.Language == nl && !sc.Forced {
+				found = true
+				break
+			}
+		}
+		if !found {
+			m = append(m, l)
+		}
+	}
+	return m
+}
+
+// Scans the library like ScanLibrary does, and for every video that misses a
+// language searches for the subtitles without downloading them. The searches
+// respect the rate limit reported by the server.
+func (s *SubtitlesService) Scan(ctx context.Context, p *ScanParameters) (*LibraryReport, error) {
+	if p == nil {
+		p = &ScanParameters{}
+	}
+
+	r, err := ScanLibrary(p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Offline {
+		return r, nil
+	}
+
+	var last *Response
+	for _, v := range r.Videos {
+		if len(v.Missing) == 0 {
+			continue
+		}
+
+		if last != nil {
+			err = waitForRate(ctx, last, p.Interval)
+			if err != nil {
+				return r, err
+			}
+		}
+
+		sp := &SubtitlesSearchParameters{
+			Languages: v.Missing,
+		}
+		h, err := MoviehashFile(v.Path)
+		if err == nil {
+			v.Moviehash = h
+			sp.Moviehash = h
+		} else {
+			rl := ParseRelease(v.Path)
+			sp.Query = rl.Title
+			sp.Year = rl.Year
+			sp.SeasonNumber = rl.Season
+			sp.EpisodeNumber = rl.Episode
+		}
+
+		d, res, err := s.searchWithRetry(ctx, sp, p.Interval)
+		if res != nil {
+			last = res
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return r, ctx.Err()
+			}
+			v.Error = err.Error()
+			continue
+		}
+
+		v.Available = map[string]int{}
+		for _, l := range v.Missing {
+			v.Available[l] = 0
+		}
+		for _, e := range d {
+			if e == nil || e.Attributes == nil || e.Attributes.Language == nil {
+				continue
+			}
+			for _, l := range v.Missing {
+				if strings.EqualFold(*e.Attributes.Language, l) {
+					v.Available[l] += 1
+				}
+			}
+		}
+	}
+
+	return r, nil
+}
+
+const rateLimitRetries = 3
+
+func (s *SubtitlesService) searchWithRetry(ctx context.Context, p *SubtitlesSearchParameters, interval time.Duration) ([]*SubtitleEntity, *Response, error) {
+	for i := 0; ; i += 1 {
+		d, res, err := s.Search(ctx, p)
+		if err == nil || i == rateLimitRetries || !isRateLimitError(err) {
+			return d, res, err
+		}
+		err = waitForRate(ctx, res, interval)
+		if err != nil {
+			return nil, res, err
+		}
+	}
+}
+
+// Reports whether the error is or wraps a RateLimitError.
+func isRateLimitError(err error) bool {
+	var rl *RateLimitError
+	return AsError(err, &rl)
+}
+
+// Waits until the rate limit of the last response allows another request, but
+// not less than the interval.
+func waitForRate(ctx context.Context, res *Response, interval time.Duration) error {
+	d := interval
+	if res != nil && res.Rate.Limit > 0 && res.Rate.Remaining <= 0 {
+		r := time.Duration(res.Rate.Reset) * time.Second
+		if r <= 0 {
+			r = time.Second
+		}
+		if r > d {
+			d = r
+		}
+	}
+	if res != nil && res.Response != nil && res.StatusCode == 429 && d < time.Second {
+		d = time.Second
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
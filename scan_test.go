@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSidecar_ParsesTheName(t *testing.T) {
+	v := "/m/Movie.2019.mkv"
+
+	a := ParseSidecar(v, "/m/Movie.2019.srt")
+	assert.Equal(t, &Sidecar{Path: "/m/Movie.2019.srt"}, a)
+
+	a = ParseSidecar(v, "/m/Movie.2019.eng.forced.srt")
+	assert.Equal(t, &Sidecar{Path: "/m/Movie.2019.eng.forced.srt", Language: "en", Forced: true}, a)
+
+	a = ParseSidecar(v, "/m/Movie.2019.pt-BR.sdh.ass")
+	assert.Equal(t, &Sidecar{Path: "/m/Movie.2019.pt-BR.sdh.ass", Language: "pt-br", HearingImpaired: true}, a)
+
+	assert.Nil(t, ParseSidecar(v, "/m/Other.en.srt"))
+	assert.Nil(t, ParseSidecar(v, "/n/Movie.2019.en.srt"))
+	assert.Nil(t, ParseSidecar(v, "/m/Movie.2019x.en.srt"))
+}
+
+func TestParseSidecar_RejectsUnknownTags(t *testing.T) {
+	v := "/m/Movie.mkv"
+
+	assert.Nil(t, ParseSidecar(v, "/m/Movie.Part.2.en.srt"))
+	assert.Nil(t, ParseSidecar(v, "/m/Movie.Extras.srt"))
+
+	a := ParseSidecar(v, "/m/Movie.2.zh_Hans.hi.srt")
+	assert.Equal(t, &Sidecar{Path: "/m/Movie.2.zh_Hans.hi.srt", Language: "zh-hans", HearingImpaired: true}, a)
+}
+
+func TestScanLibrary_ReportsMissingLanguages(t *testing.T) {
+	d := testLibrary(t)
+
+	a, err := ScanLibrary(&ScanParameters{
+		Roots: []string{d},
+		Languages: []string{"en", "de"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, a.Videos, 2)
+	assert.Equal(t, 2, a.Incomplete)
+	assert.Equal(t, filepath.Join(d, "a", "A.mkv"), a.Videos[0].Path)
+	assert.Equal(t, []string{"de"}, a.Videos[0].Missing)
+	assert.Len(t, a.Videos[0].Sidecars, 2)
+	assert.Equal(t, []string{"en", "de"}, a.Videos[1].Missing)
+}
+
+func TestSubtitlesServiceScan_ReportsAvailability(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	d := testLibrary(t)
+
+	n := 0
+	m.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		if n == 1 {
+			w.Header().Set("X-RateLimit-Limit", "5")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data": [
+			{"id": "1", "attributes": {"language": "de"}},
+			{"id": "2", "attributes": {"language": "de"}},
+			{"id": "3", "attributes": {"language": %q}}
+		]}`, r.URL.Query().Get("languages"))
+	})
+
+	ctx := context.Background()
+	a, err := c.Subtitles.Scan(ctx, &ScanParameters{
+		Roots: []string{d},
+		Languages: []string{"en", "de"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "", a.Videos[0].Error)
+	assert.Equal(t, map[string]int{"de": 3}, a.Videos[0].Available)
+	assert.NotEmpty(t, a.Videos[0].Moviehash)
+	assert.Equal(t, map[string]int{"en": 0, "de": 2}, a.Videos[1].Available)
+}
+
+func testLibrary(t *testing.T) string {
+	d := t.TempDir()
+	for _, n := range []string{
+		"a/A.mkv",
+		"a/A.en.srt",
+		"a/A.de.forced.srt",
+		"b/B.2019.avi",
+		"b/notes.txt",
+		".hidden/C.mkv",
+	} {
+		p := filepath.Join(d, n)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		require.NoError(t, err)
+		b := []byte("x")
+		if filepath.Ext(n) == ".mkv" {
+			b = make([]byte, moviehashChunkSize)
+		}
+		err = os.WriteFile(p, b, 0644)
+		require.NoError(t, err)
+	}
+	return d
+}
+
+func TestSubtitlesServiceScan_AcceptsNilParameters(t *testing.T) {
+	c, _, teardown := setup()
+	defer teardown()
+
+	r, err := c.Subtitles.Scan(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, r.Videos)
+
+	r, err = ScanLibrary(nil)
+	require.NoError(t, err)
+	assert.Empty(t, r.Videos)
+}
@@ -0,0 +1,274 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// A login session that can be reused across runs.
+type Session struct {
+	Token         string    `json:"token"`
+	User          *User     `json:"user,omitempty"`
+	ClientBaseURL string    `json:"client_base_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Stores a login session between runs.
+type TokenStore interface {
+	// Returns the stored session, or nil if there is none.
+	Load() (*Session, error)
+	Save(s *Session) error
+	Clear() error
+}
+
+// A token store backed by a file that only the owner can read. The writes are
+// atomic and guarded by an advisory lock, so the file can be shared between the
+// processes of one host. On the platforms without file locks, its methods fail
+// with ErrFileLockUnsupported.
+type FileTokenStore struct {
+	name string
+}
+
+func NewFileTokenStore(name string) *FileTokenStore {
+	return &FileTokenStore{name: name}
+}
+
+func (s *FileTokenStore) Load() (*Session, error) {
+	var r *Session
+	err := s.locked(func () error {
+		data, err := os.ReadFile(s.name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var ss Session
+		err = json.Unmarshal(data, &ss)
+		if err != nil {
+			return fmt.Errorf("rest: cannot read the session %q: %w", s.name, err)
+		}
+		if ss.Token != "" {
+			r = &ss
+		}
+		return nil
+	})
+	return r, err
+}
+
+func (s *FileTokenStore) Save(ss *Session) error {
+	data, err := json.MarshalIndent(ss, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.locked(func () error {
+		return writeFileAtomic(s.name, data, 0600)
+	})
+}
+
+func (s *FileTokenStore) Clear() error {
+	return s.locked(func () error {
+		err := os.Remove(s.name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *FileTokenStore) locked(fn func () error) error {
+	f, err := os.OpenFile(s.name+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = lockFile(f)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// Reuses a stored login session until the server rejects it, and logs in again
+// with the credentials when there is no usable session.
+type SessionManager struct {
+	mu sync.Mutex
+
+	// The client to log in with. It is not modified, the authenticated clients
+	// are copies of it.
+	Client *Client
+
+	Store       TokenStore
+	Credentials *Credentials
+
+	// Logs in again when the token expires within this time, if there are
+	// credentials to log in with. Defaults to 1h.
+	RefreshBefore time.Duration
+}
+
+const defaultSessionRefreshBefore = time.Hour
+
+// Returns a client authenticated with the stored session, or logs in and
+// stores a new session if there is none or it belongs to another user.
+func (m *SessionManager) Authenticate(ctx context.Context) (*Client, *Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.Store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s != nil && m.Credentials != nil && s.User != nil && s.User.Username != nil &&
+		*s.User.Username != m.Credentials.Username {
+		s = nil
+	}
+
+	if s != nil && m.expiresSoon(s, time.Now()) {
+		s = nil
+	}
+
+	if s == nil {
+		s, err = m.login(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c, err := m.authenticated(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, s, nil
+}
+
+// Reports whether the session has to be replaced, either because its token
+// has expired or because it is about to expire and there are credentials to
+// log in with.
+func (m *SessionManager) expiresSoon(s *Session, now time.Time) bool {
+	t, err := s.ParseToken()
+	if err != nil || t.ExpiresAt.IsZero() {
+		return false
+	}
+	if t.Expired(now) {
+		return true
+	}
+	if m.Credentials == nil {
+		return false
+	}
+	r := m.RefreshBefore
+	if r <= 0 {
+		r = defaultSessionRefreshBefore
+	}
+	return t.ValidFor(now) <= r
+}
+
+func (m *SessionManager) login(ctx context.Context) (*Session, error) {
+	if m.Credentials == nil {
+		return nil, errors.New("rest: no stored session and no credentials to log in with")
+	}
+
+	l, _, err := m.Client.Auth.Login(ctx, m.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	if l.Token == nil {
+		return nil, errors.New("rest: login response has no token")
+	}
+
+	s := &Session{
+		Token: *l.Token,
+		User: l.User,
+		ClientBaseURL: l.ClientBaseURL,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = m.Store.Save(s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *SessionManager) authenticated(s *Session) (*Client, error) {
+	c := m.Client.WithAuthToken(s.Token)
+
+	// The base URL of the session only applies to the official hosts, a client
+	// that talks to another one, such as a proxy, keeps it.
+	b := m.Client.BaseURL.String()
+	if s.ClientBaseURL != "" && (b == defaultBaseURL || b == vipBaseURL) {
+		u, err := url.Parse(s.ClientBaseURL)
+		if err != nil {
+			return nil, err
+		}
+		c.BaseURL = u
+	}
+	return c, nil
+}
+
+// Runs the function with an authenticated client. If the server rejects the
+// token, the stored session is cleared and the function is run once more with
+// a new one.
+func (m *SessionManager) Do(ctx context.Context, fn func (*Client) error) error {
+	c, _, err := m.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(c)
+	var te *AuthTokenError
+	if err == nil || !AsError(err, &te) {
+		return err
+	}
+
+	err = m.Store.Clear()
+	if err != nil {
+		return err
+	}
+
+	c, _, err = m.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+// Logs out of the stored session, if any, and clears it. The session is cleared
+// even if the server rejects the logout.
+func (m *SessionManager) Logout(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.Store.Load()
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+
+	c, err := m.authenticated(s)
+	if err == nil {
+		_, err = c.Auth.Logout(ctx)
+	}
+
+	cErr := m.Store.Clear()
+	if cErr != nil {
+		return cErr
+	}
+
+	var te *AuthTokenError
+	if AsError(err, &te) {
+		// The session has already ended on the server.
+		return nil
+	}
+	return err
+}
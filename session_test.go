@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTokenStore_SavesLoadsAndClears(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "session.json")
+	s := NewFileTokenStore(n)
+
+	a, err := s.Load()
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	e := &Session{
+		Token: "xxx",
+		User: &User{Username: AllocateString("user")},
+		ClientBaseURL: vipBaseURL,
+	}
+	err = s.Save(e)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(n)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	a, err = NewFileTokenStore(n).Load()
+	require.NoError(t, err)
+	assert.Equal(t, e, a)
+
+	err = s.Clear()
+	require.NoError(t, err)
+	a, err = s.Load()
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	err = s.Clear()
+	require.NoError(t, err)
+}
+
+func TestSessionManager_ReusesTheSessionUntilItIsRejected(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	logins := 0
+	m.HandleFunc("/login", func (w http.ResponseWriter, r *http.Request) {
+		logins += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"token": "t%d", "user": {"username": "user"}, "base_url": "vip-api.opensubtitles.com"}`, logins)
+	})
+	m.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") == "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "invalid token"}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"username": "user"}}`)
+	})
+	logouts := 0
+	m.HandleFunc("/logout", func (w http.ResponseWriter, r *http.Request) {
+		logouts += 1
+		assert.Equal(t, "Bearer t2", r.Header.Get("Authorization"))
+	})
+
+	store := NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	sm := &SessionManager{
+		Client: c,
+		Store: store,
+		Credentials: &Credentials{Username: "user", Password: "pass"},
+	}
+
+	ctx := context.Background()
+
+	ac, s, err := sm.Authenticate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "t1", s.Token)
+	assert.Equal(t, c.BaseURL, ac.BaseURL)
+	_, s, err = sm.Authenticate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "t1", s.Token)
+	assert.Equal(t, 1, logins)
+
+	calls := 0
+	err = sm.Do(ctx, func (c *Client) error {
+		calls += 1
+		_, _, err := c.Users.Get(ctx)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, logins)
+
+	err = sm.Logout(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, logouts)
+	s, err = store.Load()
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestSessionManagerAuthenticate_AppliesTheVIPBaseURL(t *testing.T) {
+	store := NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	err := store.Save(&Session{Token: "xxx", ClientBaseURL: vipBaseURL})
+	require.NoError(t, err)
+
+	sm := &SessionManager{Client: NewClient(nil), Store: store}
+	c, _, err := sm.Authenticate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, vipBaseURL, c.BaseURL.String())
+	assert.Equal(t, defaultBaseURL, sm.Client.BaseURL.String())
+}
@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type MediaServer int
+
+const (
+	Plex MediaServer = iota
+	Jellyfin
+	Kodi
+)
+
+func (m MediaServer) String() string {
+	switch m {
+	case Plex:
+		return "plex"
+	case Jellyfin:
+		return "jellyfin"
+	case Kodi:
+		return "kodi"
+	default:
+		return fmt.Sprintf("MediaServer(%d)", int(m))
+	}
+}
+
+// Returns the naming convention of the media server.
+func (m MediaServer) Convention() *SidecarConvention {
+	switch m {
+	case Jellyfin:
+		return &SidecarConvention{Forced: "forced", HearingImpaired: "sdh", NumberFirst: true}
+	case Kodi:
+		return &SidecarConvention{Forced: "forced", HearingImpaired: "hi"}
+	default:
+		return &SidecarConvention{Forced: "forced", HearingImpaired: "sdh"}
+	}
+}
+
+// Describes how a media server expects the subtitles of a video to be named,
+// such as Video.en.srt, Video.en.forced.srt or Video.en.sdh.srt.
+type SidecarConvention struct {
+	// The tag of the subtitles for the foreign parts only.
+	Forced string
+
+	// The tag of the subtitles for the hearing impaired.
+	HearingImpaired string
+
+	// Puts the number that tells several subtitles of one language apart
+	// before the language, as in Video.2.en.srt, where the media server takes
+	// it for a title, instead of after the tags, as in Video.en.2.srt.
+	NumberFirst bool
+}
+
+type SidecarParameters struct {
+	// The media server whose convention is used. Defaults to Plex.
+	Server MediaServer
+
+	// Overrides the convention of the server.
+	Convention *SidecarConvention
+
+	// The extension of the subtitle, such as ".srt". Defaults to the extension
+	// of the file name of the subtitle, or ".srt" if it has none.
+	Extension string
+
+	// Reports whether a path is taken. Defaults to checking whether the file
+	// exists.
+	Taken func (path string) bool
+}
+
+// Returns the path of the sidecar of the subtitle next to the video, named
+// after the language of the subtitle and whether it covers the foreign parts
+// only or is for the hearing impaired. If the path is taken, such as by
+// another subtitle of the same language, the name is numbered, starting from
+// 2.
+func SidecarPath(video string, s *Subtitle, p *SidecarParameters) (string, error) {
+	if p == nil {
+		p = &SidecarParameters{}
+	}
+	if s == nil || s.Language == nil || *s.Language == "" {
+		return "", errors.New("rest: subtitle has no language")
+	}
+
+	c := p.Convention
+	if c == nil {
+		c = p.Server.Convention()
+	}
+
+	ext := p.Extension
+	if ext == "" && len(s.Files) > 0 && s.Files[0].FileName != nil {
+		ext = filepath.Ext(*s.Files[0].FileName)
+	}
+	if ext == "" {
+		ext = ".srt"
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	taken := p.Taken
+	if taken == nil {
+		taken = fileExists
+	}
+
+	tags := []string{*s.Language}
+	if s.ForeignPartsOnly != nil && *s.ForeignPartsOnly && c.Forced != "" {
+		tags = append(tags, c.Forced)
+	}
+	if s.HearingImpaired != nil && *s.HearingImpaired && c.HearingImpaired != "" {
+		tags = append(tags, c.HearingImpaired)
+	}
+
+	base := strings.TrimSuffix(video, filepath.Ext(video))
+	for n := 1; ; n += 1 {
+		t := tags
+		if n > 1 {
+			num := strconv.Itoa(n)
+			if c.NumberFirst {
+				t = append([]string{num}, tags...)
+			} else {
+				t = append(append([]string(nil), tags...), num)
+			}
+		}
+		path := base + "." + strings.Join(t, ".") + ext
+		if !taken(path) {
+			return path, nil
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// Downloads the first file of the subtitle next to the video, named the way
+// the media server expects it, and writes its provenance next to it. A path
+// that already holds the same file is reused, so the download is skipped if the
+// file is unedited.
+func (s *SubtitlesService) DownloadSidecar(ctx context.Context, video string, e *SubtitleEntity, p *SidecarParameters) (*DownloadedFile, *Response, error) {
+	h, _ := MoviehashFile(video)
+	pv, err := NewProvenance(e, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := SidecarParameters{}
+	if p != nil {
+		c = *p
+	}
+	taken := c.Taken
+	if taken == nil {
+		taken = fileExists
+	}
+	c.Taken = func (path string) bool {
+		if !taken(path) {
+			return false
+		}
+		old, err := ReadProvenance(path)
+		return err != nil || old.FileID != pv.FileID
+	}
+
+	path, err := SidecarPath(video, e.Attributes, &c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := &DownloadToPathParameters{}
+	if e.Attributes.UploadDate != nil {
+		o.ModTime = *e.Attributes.UploadDate
+	}
+	return s.DownloadWithProvenance(ctx, pv, path, o)
+}
@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSidecarPath_NamesTheSubtitleAfterItsAttributes(t *testing.T) {
+	tests := []struct {
+		server MediaServer
+		forced bool
+		hi     bool
+		want   string
+	}{
+		{Plex, false, false, "Video.en.srt"},
+		{Plex, true, false, "Video.en.forced.srt"},
+		{Plex, false, true, "Video.en.sdh.srt"},
+		{Plex, true, true, "Video.en.forced.sdh.srt"},
+		{Jellyfin, false, true, "Video.en.sdh.srt"},
+		{Kodi, false, true, "Video.en.hi.srt"},
+	}
+
+	dir := t.TempDir()
+	video := filepath.Join(dir, "Video.mkv")
+	for _, tt := range tests {
+		s := &Subtitle{
+			Language: AllocateString("en"),
+			ForeignPartsOnly: AllocateBool(tt.forced),
+			HearingImpaired: AllocateBool(tt.hi),
+		}
+		path, err := SidecarPath(video, s, &SidecarParameters{Server: tt.server})
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, tt.want), path, "%s", tt.server)
+
+		sc := ParseSidecar(video, path)
+		require.NotNil(t, sc)
+		assert.Equal(t, "en", sc.Language)
+		assert.Equal(t, tt.forced, sc.Forced)
+		assert.Equal(t, tt.hi, sc.HearingImpaired)
+	}
+}
+
+func TestSidecarPath_TakesTheExtensionOfTheFile(t *testing.T) {
+	s := &Subtitle{
+		Language: AllocateString("pt-BR"),
+		Files: []*File{{FileName: AllocateString("release.ass")}},
+	}
+
+	path, err := SidecarPath("Video.mkv", s, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Video.pt-BR.ass", path)
+
+	path, err = SidecarPath("Video.mkv", s, &SidecarParameters{Extension: "vtt"})
+	require.NoError(t, err)
+	assert.Equal(t, "Video.pt-BR.vtt", path)
+}
+
+func TestSidecarPath_NumbersTheCollisions(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "Video.mkv")
+	err := os.WriteFile(filepath.Join(dir, "Video.en.srt"), nil, 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "Video.en.2.srt"), nil, 0644)
+	require.NoError(t, err)
+
+	s := &Subtitle{Language: AllocateString("en")}
+	path, err := SidecarPath(video, s, nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.en.3.srt"), path)
+
+	sc := ParseSidecar(video, path)
+	require.NotNil(t, sc)
+	assert.Equal(t, "en", sc.Language)
+
+	path, err = SidecarPath(video, s, &SidecarParameters{Server: Jellyfin})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.2.en.srt"), path)
+}
+
+func TestSidecarPath_UsesTheTakenFunction(t *testing.T) {
+	taken := map[string]bool{"Video.en.srt": true}
+	p := &SidecarParameters{
+		Convention: &SidecarConvention{Forced: "foreign", HearingImpaired: "cc"},
+		Taken: func (path string) bool {
+			return taken[path]
+		},
+	}
+
+	path, err := SidecarPath("Video.mkv", &Subtitle{Language: AllocateString("en")}, p)
+	require.NoError(t, err)
+	assert.Equal(t, "Video.en.2.srt", path)
+
+	s := &Subtitle{Language: AllocateString("en"), ForeignPartsOnly: AllocateBool(true)}
+	path, err = SidecarPath("Video.mkv", s, p)
+	require.NoError(t, err)
+	assert.Equal(t, "Video.en.foreign.srt", path)
+}
+
+func TestSidecarPath_ReturnsAnErrorWithoutALanguage(t *testing.T) {
+	_, err := SidecarPath("Video.mkv", &Subtitle{}, nil)
+	assert.Error(t, err)
+}
+
+func TestSubtitlesServiceDownloadSidecar_DownloadsNextToTheVideo(t *testing.T) {
+	client, _, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	dir := t.TempDir()
+	video := filepath.Join(dir, "Video.mkv")
+	ud := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := &SubtitleEntity{
+		Attributes: &Subtitle{
+			Language: AllocateString("en"),
+			HearingImpaired: AllocateBool(true),
+			Files: []*File{{FileID: AllocateID(1), FileName: AllocateString("release.srt")}},
+			UploadDate: &ud,
+		},
+	}
+
+	f, _, err := client.Subtitles.DownloadSidecar(context.Background(), video, e, nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.en.sdh.srt"), f.Path)
+
+	data, err := os.ReadFile(f.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "subtitle", string(data))
+
+	st, err := os.Stat(f.Path)
+	require.NoError(t, err)
+	assert.True(t, ud.Equal(st.ModTime()))
+}
+
+func TestSubtitlesServiceDownloadSidecar_ReusesThePathOfTheSameFile(t *testing.T) {
+	client, n, teardown := setupDownload("subtitle")
+	defer teardown()
+
+	dir := t.TempDir()
+	video := filepath.Join(dir, "Video.mkv")
+	entity := func (id int64) *SubtitleEntity {
+		return &SubtitleEntity{
+			Attributes: &Subtitle{
+				Language: AllocateString("en"),
+				Files: []*File{{FileID: AllocateID(id)}},
+			},
+		}
+	}
+	ctx := context.Background()
+
+	f, _, err := client.Subtitles.DownloadSidecar(ctx, video, entity(1), nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.en.srt"), f.Path)
+
+	f, _, err = client.Subtitles.DownloadSidecar(ctx, video, entity(1), nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.en.srt"), f.Path)
+	assert.True(t, f.Skipped)
+	assert.Equal(t, 1, *n)
+
+	f, _, err = client.Subtitles.DownloadSidecar(ctx, video, entity(2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Video.en.2.srt"), f.Path)
+
+	p, err := ReadProvenance(f.Path)
+	require.NoError(t, err)
+	assert.Equal(t, ID(2), p.FileID)
+}
@@ -0,0 +1,17 @@
+module github.com/opensubtitlescli/rest/slogrest
+
+go 1.21
+
+replace github.com/opensubtitlescli/rest => ../
+
+require (
+	github.com/opensubtitlescli/rest v0.0.0-20261018215931-d2c93d62ad7b
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,121 @@
+// Logs the exchanges of the rest client with log/slog. It is a separate module,
+// so the client does not require the Go version that log/slog needs.
+package slogrest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/opensubtitlescli/rest"
+)
+
+const defaultMaxBodySize = 64 * 1024
+
+type LoggingParameters struct {
+	// The level of the successful exchanges. Failed ones are logged one level
+	// higher. Without parameters, the exchanges are logged at the debug level.
+	Level slog.Level
+
+	// Logs the request and response headers, with the secrets redacted.
+	Headers bool
+
+	// Logs the JSON and text request and response bodies, with the secrets
+	// redacted.
+	Bodies bool
+
+	// The largest body to log, in bytes. Larger bodies are truncated. Defaults
+	// to 64KB.
+	MaxBodySize int
+}
+
+// Creates a middleware that logs every exchange of the client with the method,
+// URL, status, duration, rate limit and quota, and optionally the headers and
+// bodies. Secrets are redacted before anything reaches the logger.
+func Logging(l *slog.Logger, p *LoggingParameters) rest.Middleware {
+	if p == nil {
+		p = &LoggingParameters{Level: slog.LevelDebug}
+	}
+	max := p.MaxBodySize
+	if max <= 0 {
+		max = defaultMaxBodySize
+	}
+
+	return func (next rest.RequestHandler) rest.RequestHandler {
+		return func (ctx context.Context, req *http.Request) (*rest.Response, error) {
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.String()),
+			}
+			if p.Headers {
+				attrs = append(attrs, slog.Any("request_headers", rest.RedactHeaders(req.Header)))
+			}
+			if p.Bodies && req.Body != nil && req.GetBody != nil {
+				b, err := req.GetBody()
+				if err == nil {
+					attrs = append(attrs, slog.String("request_body", readBody(b, req.Header, max)))
+				}
+			}
+
+			start := time.Now()
+			res, err := next(ctx, req)
+			attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+
+			level := p.Level
+			if err != nil {
+				level += 4
+			}
+
+			if res != nil && res.Response != nil {
+				attrs = append(
+					attrs,
+					slog.Int("status", res.StatusCode),
+					slog.Group(
+						"rate",
+						slog.Int("limit", res.Rate.Limit),
+						slog.Int("remaining", res.Rate.Remaining),
+						slog.Int("reset", res.Rate.Reset),
+					),
+				)
+				if !res.Quota.ResetTimeUTC.IsZero() {
+					attrs = append(attrs, slog.Group(
+						"quota",
+						slog.Int("remaining", res.Quota.Remaining),
+						slog.Int("requests", res.Quota.Requests),
+						slog.Time("reset_time_utc", res.Quota.ResetTimeUTC),
+					))
+				}
+				if p.Headers {
+					attrs = append(attrs, slog.Any("response_headers", rest.RedactHeaders(res.Header)))
+				}
+				if p.Bodies && res.Body != nil && rest.IsTextBody(res.Header) {
+					data, rErr := io.ReadAll(res.Body)
+					res.Body.Close()
+					res.Body = io.NopCloser(bytes.NewReader(data))
+					if rErr == nil {
+						attrs = append(attrs, slog.String("response_body", rest.RedactBody(data, res.Header, max)))
+					}
+				}
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+
+			l.LogAttrs(ctx, level, "rest: exchange", attrs...)
+
+			return res, err
+		}
+	}
+}
+
+func readBody(b io.ReadCloser, h http.Header, max int) string {
+	defer b.Close()
+	data, err := io.ReadAll(b)
+	if err != nil {
+		return ""
+	}
+	return rest.RedactBody(data, h, max)
+}
@@ -0,0 +1,143 @@
+package slogrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/opensubtitlescli/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup() (*rest.Client, *http.ServeMux, func ()) {
+	m := http.NewServeMux()
+	s := httptest.NewServer(m)
+
+	c := rest.NewClient(nil)
+	c.BaseURL, _ = url.Parse(s.URL + "/")
+
+	return c, m, s.Close
+}
+
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var b bytes.Buffer
+	h := slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(h), &b
+}
+
+func decodeLogRecord(t *testing.T, b *bytes.Buffer) map[string]interface {} {
+	var r map[string]interface {}
+	err := json.Unmarshal(b.Bytes(), &r)
+	require.NoError(t, err)
+	return r
+}
+
+func TestLogging_LogsTheExchange(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5")
+		w.Header().Set("X-RateLimit-Remaining", "4")
+		w.Header().Set("X-RateLimit-Reset", "1")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"user_id": 1}}`)
+	})
+
+	l, b := newTestLogger()
+	c.Use(Logging(l, nil))
+
+	_, _, err := c.Users.Get(context.Background())
+	require.NoError(t, err)
+
+	r := decodeLogRecord(t, b)
+	assert.Equal(t, "DEBUG", r["level"])
+	assert.Equal(t, "GET", r["method"])
+	assert.Contains(t, r["url"], "/infos/user")
+	assert.Equal(t, 200.0, r["status"])
+	assert.Contains(t, r, "duration")
+	assert.Equal(t, map[string]interface {}{"limit": 5.0, "remaining": 4.0, "reset": 1.0}, r["rate"])
+	assert.NotContains(t, r, "quota")
+	assert.NotContains(t, r, "request_headers")
+	assert.NotContains(t, r, "response_body")
+}
+
+func TestLogging_RedactsTheSecrets(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/login", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"token": "secret-token", "user": {"user_id": 1}, "status": 200}`)
+	})
+
+	c.APIKey = "secret-key"
+	c = c.WithAuthToken("secret-bearer")
+
+	l, b := newTestLogger()
+	c.Use(Logging(l, &LoggingParameters{Headers: true, Bodies: true}))
+
+	lg, _, err := c.Auth.Login(context.Background(), &rest.Credentials{Username: "u", Password: "secret-password"})
+	require.NoError(t, err)
+	assert.Equal(t, "secret-token", *lg.Token)
+
+	s := b.String()
+	assert.NotContains(t, s, "secret-key")
+	assert.NotContains(t, s, "secret-bearer")
+	assert.NotContains(t, s, "secret-password")
+	assert.NotContains(t, s, "secret-token")
+
+	r := decodeLogRecord(t, b)
+	assert.Equal(t, `{"password":"[REDACTED]","username":"u"}`, r["request_body"])
+	assert.Equal(t, `{"status":200,"token":"[REDACTED]","user":{"user_id":1}}`, r["response_body"])
+	h := r["request_headers"].(map[string]interface {})
+	assert.Equal(t, []interface {}{"[REDACTED]"}, h["Api-Key"])
+}
+
+func TestLogging_LogsTheErrorsOneLevelHigher(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/infos/user", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "Throttle limit reached. Retry later."}`)
+	})
+
+	l, b := newTestLogger()
+	c.Use(Logging(l, &LoggingParameters{Level: slog.LevelInfo}))
+
+	_, _, err := c.Users.Get(context.Background())
+	require.Error(t, err)
+
+	r := decodeLogRecord(t, b)
+	assert.Equal(t, "WARN", r["level"])
+	assert.Equal(t, 429.0, r["status"])
+	assert.Contains(t, r["error"], "Throttle limit reached")
+}
+
+func TestLogging_TruncatesTheBodies(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	m.HandleFunc("/infos/formats", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"output_formats": ["srt", "vtt"]}}`)
+	})
+
+	l, b := newTestLogger()
+	c.Use(Logging(l, &LoggingParameters{Bodies: true, MaxBodySize: 10}))
+
+	_, _, err := c.Formats.List(context.Background())
+	require.NoError(t, err)
+
+	r := decodeLogRecord(t, b)
+	assert.Equal(t, `{"data":{"...[TRUNCATED]`, r["response_body"])
+}
@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A single timed block of a subtitle.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+var srtTimingRe = regexp.MustCompile(
+	`^\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`,
+)
+
+// Parses cues in the SubRip (SRT) format.
+func ParseSRT(r io.Reader) ([]*Cue, error) {
+	var cues []*Cue
+	var cue *Cue
+	var text []string
+
+	flush := func () {
+		if cue != nil {
+			cue.Text = strings.Join(text, "\n")
+			cues = append(cues, cue)
+		}
+		cue = nil
+		text = nil
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	n := 0
+	for s.Scan() {
+		n += 1
+		l := strings.TrimRight(s.Text(), "\r")
+		if n == 1 {
+			l = strings.TrimPrefix(l, "\ufeff")
+		}
+
+		m := srtTimingRe.FindStringSubmatch(l)
+		if m != nil {
+			// The index line, if any, has already been collected as text of the
+			// previous cue, so it has to be dropped.
+			if cue != nil && len(text) > 0 {
+				_, err := strconv.Atoi(strings.TrimSpace(text[len(text)-1]))
+				if err == nil {
+					text = text[:len(text)-1]
+				}
+			}
+			for len(text) > 0 && text[len(text)-1] == "" {
+				text = text[:len(text)-1]
+			}
+			flush()
+			cue = &Cue{
+				Start: srtDuration(m[1:5]),
+				End: srtDuration(m[5:9]),
+			}
+			continue
+		}
+
+		if cue == nil {
+			continue
+		}
+		if l == "" && len(text) == 0 {
+			continue
+		}
+		text = append(text, l)
+	}
+
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for len(text) > 0 && strings.TrimSpace(text[len(text)-1]) == "" {
+		text = text[:len(text)-1]
+	}
+	flush()
+
+	if len(cues) == 0 && n > 0 {
+		return nil, fmt.Errorf("rest: no srt cues found")
+	}
+
+	return cues, nil
+}
+
+func srtDuration(m []string) time.Duration {
+	h, _ := strconv.Atoi(m[0])
+	mi, _ := strconv.Atoi(m[1])
+	s, _ := strconv.Atoi(m[2])
+	ms := m[3]
+	for len(ms) < 3 {
+		ms += "0"
+	}
+	f, _ := strconv.Atoi(ms)
+	return time.Duration(h)*time.Hour +
+		time.Duration(mi)*time.Minute +
+		time.Duration(s)*time.Second +
+		time.Duration(f)*time.Millisecond
+}
+
+// Writes cues in the SubRip (SRT) format.
+func WriteSRT(w io.Writer, cues []*Cue) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		_, err := fmt.Fprintf(
+			bw,
+			"%d\n%s --> %s\n%s\n\n",
+			i + 1,
+			formatSRTDuration(c.Start),
+			formatSRTDuration(c.End),
+			c.Text,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func formatSRTDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf(
+		"%02d:%02d:%02d,%03d",
+		ms / 3600000,
+		ms / 60000 % 60,
+		ms / 1000 % 60,
+		ms % 1000,
+	)
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSRT_ParsesCues(t *testing.T) {
+	s := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\nthere\r\n\r\n2\r\n00:01:02.05 --> 00:01:03,000\r\n3\r\n\r\n"
+	a, err := ParseSRT(strings.NewReader(s))
+	require.NoError(t, err)
+
+	e := []*Cue{
+		{
+			Start: time.Second,
+			End: 2500 * time.Millisecond,
+			Text: "Hello\nthere",
+		},
+		{
+			Start: time.Minute + 2050 * time.Millisecond,
+			End: time.Minute + 3 * time.Second,
+			Text: "3",
+		},
+	}
+	assert.Equal(t, e, a)
+}
+
+func TestParseSRT_ReturnsAnErrorIfThereAreNoCues(t *testing.T) {
+	_, err := ParseSRT(strings.NewReader("not a subtitle"))
+	assert.EqualError(t, err, "rest: no srt cues found")
+}
+
+func TestWriteSRT_WritesCues(t *testing.T) {
+	c := []*Cue{
+		{
+			Start: time.Hour + time.Second,
+			End: time.Hour + 2 * time.Second + 5 * time.Millisecond,
+			Text: "Hello",
+		},
+	}
+	var b bytes.Buffer
+	err := WriteSRT(&b, c)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n01:00:01,000 --> 01:00:02,005\nHello\n\n", b.String())
+
+	a, err := ParseSRT(&b)
+	require.NoError(t, err)
+	assert.Equal(t, c, a)
+}
@@ -30,6 +30,7 @@ type Subtitle struct {
 	HearingImpaired   *bool           `json:"hearing_impaired,omitempty"`
 	Language          *string         `json:"language,omitempty"`
 	MachineTranslated *bool           `json:"machine_translated,omitempty"`
+	MoviehashMatch    *bool           `json:"moviehash_match,omitempty"`
 	NewDownloadCount  *int            `json:"new_download_count,omitempty"`
 	Ratings           *float32        `json:"ratings,omitempty"`
 	RelatedLinks      []*RelatedLink  `json:"related_links,omitempty"`
@@ -95,7 +96,9 @@ type SubtitlesDownloadResponse struct {
 	// UK  *string `json:"uk,omitempty"`
 }
 
-// Requests a download URL for a subtitles.
+// Requests a download URL for a subtitles. If the quota coordinator of the
+// client fails to record the download, the URL is returned together with a
+// QuotaCommitError.
 //
 // [OpenSubtitles Reference]
 //
@@ -111,12 +114,55 @@ func (s *SubtitlesService) Download(ctx context.Context, p *SubtitlesDownloadPar
 		return nil, nil, err
 	}
 
+	l := s.client.DownloadLedger
+	if l != nil {
+		err = l.checkReserve()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var slot *QuotaSlot
+	if s.client.QuotaCoordinator != nil {
+		slot, err = s.client.QuotaCoordinator.Reserve()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	var r *SubtitlesDownloadResponse
 	res, err := s.client.Do(ctx, req, &r)
+
+	var cErr error
+	if slot != nil {
+		var qe *QuotaError
+		switch {
+		case err == nil:
+			cErr = slot.Commit(res.Quota)
+		case AsError(err, &qe):
+			cErr = slot.Commit(qe.Quota)
+		default:
+			cErr = slot.Release()
+		}
+	}
+	if l != nil {
+		lErr := l.recordCall(ctx, p, res, err)
+		if cErr == nil {
+			cErr = lErr
+		}
+	}
+
 	if err != nil {
 		return nil, res, err
 	}
 
+	s.client.count(ctx, MetricDownloads)
+
+	if cErr != nil {
+		// The quota is spent, so the link is returned with the error.
+		return r, res, &QuotaCommitError{Err: cErr}
+	}
+
 	return r, res, nil
 }
 
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The claims of a bearer token returned by the login. The signature of the
+// token is not verified, the claims are only meant to tell when to log in
+// again.
+type Token struct {
+	Raw       string
+	UserID    ID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Parses the claims of a JSON Web Token without verifying its signature.
+func ParseToken(s string) (*Token, error) {
+	p := strings.Split(s, ".")
+	if len(p) != 3 {
+		return nil, fmt.Errorf("rest: token must have 3 parts, but it has %d", len(p))
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(p[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot decode the token claims: %w", err)
+	}
+
+	var c map[string]interface {}
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("rest: cannot decode the token claims: %w", err)
+	}
+
+	t := &Token{Raw: s}
+	if v, ok := c["iat"].(float64); ok {
+		t.IssuedAt = unixTime(v)
+	}
+	if v, ok := c["exp"].(float64); ok {
+		t.ExpiresAt = unixTime(v)
+	}
+
+	// The claim that holds the user ID is not documented, so the common ones
+	// are tried in turn.
+	for _, k := range []string{"user_id", "uid", "id", "sub"} {
+		switch v := c[k].(type) {
+		case float64:
+			t.UserID = ID(v)
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			t.UserID = ID(i)
+		default:
+			continue
+		}
+		break
+	}
+
+	return t, nil
+}
+
+func unixTime(v float64) time.Time {
+	s, f := math.Modf(v)
+	return time.Unix(int64(s), int64(f*1e9)).UTC()
+}
+
+// Reports whether the token has expired at the given time. A token without an
+// expiry never expires.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Returns the time left until the token expires, or zero if it has expired or
+// has no expiry.
+func (t *Token) ValidFor(now time.Time) time.Duration {
+	if t.ExpiresAt.IsZero() || t.Expired(now) {
+		return 0
+	}
+	return t.ExpiresAt.Sub(now)
+}
+
+// Describes the validity of the token for humans, such as "session valid for 5
+// hours".
+func (t *Token) Validity(now time.Time) string {
+	switch {
+	case t.ExpiresAt.IsZero():
+		return "session has no expiry"
+	case t.Expired(now):
+		return "session expired"
+	}
+
+	d := t.ValidFor(now)
+	switch {
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("session valid for %d hours", int(d/time.Hour))
+	case d >= time.Hour:
+		return "session valid for 1 hour"
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("session valid for %d minutes", int(d/time.Minute))
+	default:
+		return "session valid for less than 2 minutes"
+	}
+}
+
+// Parses the claims of the token of the login.
+func (l *Login) ParseToken() (*Token, error) {
+	if l.Token == nil {
+		return nil, fmt.Errorf("rest: login has no token")
+	}
+	return ParseToken(*l.Token)
+}
+
+// Parses the claims of the token of the session.
+func (s *Session) ParseToken() (*Token, error) {
+	return ParseToken(s.Token)
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToken_ParsesTheClaims(t *testing.T) {
+	s := testToken(`{"iat": 1700000000, "exp": 1700086400, "user_id": "42"}`)
+	a, err := ParseToken(s)
+	require.NoError(t, err)
+
+	e := &Token{
+		Raw: s,
+		UserID: 42,
+		IssuedAt: time.Unix(1700000000, 0).UTC(),
+		ExpiresAt: time.Unix(1700086400, 0).UTC(),
+	}
+	assert.Equal(t, e, a)
+
+	a, err = ParseToken(testToken(`{"sub": "user", "id": 7}`))
+	require.NoError(t, err)
+	assert.Equal(t, ID(7), a.UserID)
+	assert.True(t, a.ExpiresAt.IsZero())
+}
+
+func TestParseToken_ReturnsAnErrorIfTheTokenIsMalformed(t *testing.T) {
+	_, err := ParseToken("xxx")
+	assert.EqualError(t, err, "rest: token must have 3 parts, but it has 1")
+
+	_, err = ParseToken("a.!.c")
+	assert.ErrorContains(t, err, "rest: cannot decode the token claims")
+}
+
+func TestTokenValidity_DescribesTheValidity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tk := &Token{ExpiresAt: now.Add(5 * time.Hour + 30 * time.Minute)}
+
+	assert.False(t, tk.Expired(now))
+	assert.Equal(t, 5 * time.Hour + 30 * time.Minute, tk.ValidFor(now))
+	assert.Equal(t, "session valid for 5 hours", tk.Validity(now))
+	assert.Equal(t, "session valid for 1 hour", tk.Validity(now.Add(4 * time.Hour)))
+	assert.Equal(t, "session valid for 30 minutes", tk.Validity(now.Add(5 * time.Hour)))
+	assert.Equal(t, "session expired", tk.Validity(now.Add(6 * time.Hour)))
+	assert.Equal(t, time.Duration(0), tk.ValidFor(now.Add(6 * time.Hour)))
+	assert.Equal(t, "session has no expiry", (&Token{}).Validity(now))
+}
+
+func TestSessionManagerAuthenticate_RefreshesAheadOfExpiry(t *testing.T) {
+	c, m, teardown := setup()
+	defer teardown()
+
+	fresh := testToken(fmt.Sprintf(`{"exp": %d}`, time.Now().Add(24 * time.Hour).Unix()))
+	m.HandleFunc("/login", func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"token": %q}`, fresh)
+	})
+
+	store := NewFileTokenStore(filepath.Join(t.TempDir(), "session.json"))
+	err := store.Save(&Session{
+		Token: testToken(fmt.Sprintf(`{"exp": %d}`, time.Now().Add(30 * time.Minute).Unix())),
+	})
+	require.NoError(t, err)
+
+	sm := &SessionManager{Client: c, Store: store}
+	_, s, err := sm.Authenticate(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, fresh, s.Token)
+
+	sm.Credentials = &Credentials{Username: "user"}
+	_, s, err = sm.Authenticate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, fresh, s.Token)
+}
+
+func testToken(claims string) string {
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+}
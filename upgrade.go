@@ -0,0 +1,335 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+const (
+	UpgradeCurrent  = "current"
+	UpgradeProposed = "proposed"
+	UpgradeApplied  = "applied"
+	UpgradeEdited   = "edited"
+	UpgradeDeferred = "deferred"
+	UpgradeFailed   = "failed"
+)
+
+type UpgradeParameters struct {
+	// The directories to walk for the subtitles that have a provenance.
+	Roots []string
+
+	// Replaces the subtitles that have a better candidate. Without it, the
+	// upgrades are only reported.
+	Apply bool
+
+	// The least score a candidate must gain over the current subtitle to be
+	// proposed.
+	MinImprovement float64
+
+	// The most replacements to download in one run. Zero means no limit.
+	MaxDownloads int
+
+	// The number of downloads to keep in reserve. Once the quota drops to it,
+	// the remaining replacements are deferred.
+	Reserve int
+
+	// The least time to wait between two requests, on top of the rate limit
+	// reported by the server.
+	Interval time.Duration
+
+	// Defaults to the weights that favor the release match.
+	Weights *RankWeights
+}
+
+type UpgradeReport struct {
+	Upgrades []*SubtitleUpgrade `json:"upgrades"`
+
+	// The number of subtitles that have a better candidate, and the number of
+	// them that were replaced.
+	Proposed int `json:"proposed"`
+	Applied  int `json:"applied"`
+}
+
+type SubtitleUpgrade struct {
+	Path    string      `json:"path"`
+	Video   string      `json:"video,omitempty"`
+	Current *Provenance `json:"current"`
+	Status  string      `json:"status"`
+
+	// The best candidate, if it is better than the current subtitle.
+	Candidate *RankedSubtitle `json:"candidate,omitempty"`
+
+	CurrentScore   float64  `json:"current_score"`
+	CandidateScore float64  `json:"candidate_score,omitempty"`
+	Reasons        []string `json:"reasons,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// Looks for better subtitles for the ones downloaded with a provenance. Every
+// subtitle is searched for again, and the candidates of the same language and
+// kind are ranked along with it. A candidate that scores higher is proposed,
+// and with Apply it replaces the subtitle, unless the subtitle has been edited
+// since the download. The replacements stop at MaxDownloads or when the quota
+// drops to the reserve, and the rest are reported as deferred.
+func (s *SubtitlesService) Upgrade(ctx context.Context, p *UpgradeParameters) (*UpgradeReport, error) {
+	if p == nil {
+		p = &UpgradeParameters{}
+	}
+
+	r := &UpgradeReport{
+		Upgrades: []*SubtitleUpgrade{},
+	}
+
+	for _, root := range p.Roots {
+		u, err := collectUpgrades(root)
+		if err != nil {
+			return nil, err
+		}
+		r.Upgrades = append(r.Upgrades, u...)
+	}
+
+	var last *Response
+	for _, u := range r.Upgrades {
+		if u.Status != "" {
+			continue
+		}
+
+		if last != nil {
+			err := waitForRate(ctx, last, p.Interval)
+			if err != nil {
+				return r, err
+			}
+		}
+
+		res, err := s.rankUpgrade(ctx, u, p)
+		if res != nil {
+			last = res
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return r, ctx.Err()
+			}
+			u.Status = UpgradeFailed
+			u.Error = err.Error()
+			continue
+		}
+		if u.Status == UpgradeProposed {
+			r.Proposed += 1
+		}
+	}
+
+	if !p.Apply {
+		return r, nil
+	}
+
+	remaining := -1
+	if s.client.QuotaCoordinator != nil {
+		n, ok, err := s.client.QuotaCoordinator.Available()
+		if err == nil && ok {
+			remaining = n
+		}
+	}
+
+	for _, u := range r.Upgrades {
+		if u.Status != UpgradeProposed {
+			continue
+		}
+
+		edited, err := u.Current.Edited(u.Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			u.Status = UpgradeFailed
+			u.Error = err.Error()
+			continue
+		}
+		if edited {
+			u.Status = UpgradeEdited
+			continue
+		}
+
+		if p.MaxDownloads > 0 && r.Applied >= p.MaxDownloads {
+			u.Status = UpgradeDeferred
+			continue
+		}
+		if remaining >= 0 && remaining <= p.Reserve {
+			u.Status = UpgradeDeferred
+			continue
+		}
+
+		if last != nil {
+			err = waitForRate(ctx, last, p.Interval)
+			if err != nil {
+				return r, err
+			}
+		}
+
+		res, err := s.applyUpgrade(ctx, u)
+		if res != nil {
+			last = res
+			if res.Quota.Requests > 0 || !res.Quota.ResetTimeUTC.IsZero() {
+				remaining = res.Quota.Remaining
+			}
+		}
+
+		var qe *QuotaError
+		switch {
+		case err == nil:
+			u.Status = UpgradeApplied
+			r.Applied += 1
+		case ctx.Err() != nil:
+			return r, ctx.Err()
+		case AsError(err, &qe):
+			u.Status = UpgradeDeferred
+			u.Error = err.Error()
+			remaining = 0
+		default:
+			u.Status = UpgradeFailed
+			u.Error = err.Error()
+		}
+	}
+
+	return r, nil
+}
+
+// Walks the directory for the subtitles that have a provenance.
+func collectUpgrades(root string) ([]*SubtitleUpgrade, error) {
+	subs, err := collectProvenance(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*SubtitleUpgrade
+	for _, ls := range subs {
+		u := &SubtitleUpgrade{Path: ls.Path, Video: ls.Video, Current: ls.Provenance}
+		if ls.Err != nil {
+			u.Status = UpgradeFailed
+			u.Error = ls.Err.Error()
+		}
+		r = append(r, u)
+	}
+	return r, nil
+}
+
+// Searches for the subtitle again and ranks the candidates of the same kind
+// along with it.
+func (s *SubtitlesService) rankUpgrade(ctx context.Context, u *SubtitleUpgrade, p *UpgradeParameters) (*Response, error) {
+	pv := u.Current
+
+	sp := pv.SearchParameters()
+	if sp.Moviehash == "" && u.Video != "" {
+		h, err := MoviehashFile(u.Video)
+		if err == nil {
+			sp.Moviehash = h
+		}
+	}
+	if sp.ID == 0 && sp.Moviehash == "" {
+		n := u.Video
+		if n == "" {
+			n = pv.Release
+		}
+		rl := ParseRelease(n)
+		if rl.Title == "" {
+			return nil, errors.New("rest: nothing to search for")
+		}
+		sp.Query = rl.Title
+		sp.Year = rl.Year
+		sp.SeasonNumber = rl.Season
+		sp.EpisodeNumber = rl.Episode
+	}
+
+	d, res, err := s.searchWithRetry(ctx, sp, p.Interval)
+	if err != nil {
+		return res, err
+	}
+
+	var f []*SubtitleEntity
+	found := false
+	for _, e := range d {
+		if e == nil || e.Attributes == nil || !pv.sameKind(e.Attributes) {
+			continue
+		}
+		if pv.same(e.Attributes) {
+			found = true
+		}
+		f = append(f, e)
+	}
+	if !found {
+		// The subtitle is no longer listed, so it competes with what it was
+		// known for when it was downloaded.
+		f = append(f, pv.entity())
+	}
+
+	ranked := RankSubtitles(f, &RankParameters{
+		FileName: u.Video,
+		Weights: p.Weights,
+	})
+
+	var cur *RankedSubtitle
+	for _, rc := range ranked {
+		if pv.same(rc.Entity.Attributes) {
+			cur = rc
+			break
+		}
+	}
+	u.CurrentScore = cur.Score
+
+	best := ranked[0]
+	if best == cur || best.Score - cur.Score <= p.MinImprovement {
+		u.Status = UpgradeCurrent
+		return res, nil
+	}
+
+	u.Status = UpgradeProposed
+	u.Candidate = best
+	u.CandidateScore = best.Score
+	u.Reasons = append(u.Reasons, best.Reasons...)
+	u.Reasons = append(u.Reasons, fmt.Sprintf("scored %.2f over %.2f", best.Score, cur.Score))
+	return res, nil
+}
+
+// Downloads the candidate over the subtitle.
+func (s *SubtitlesService) applyUpgrade(ctx context.Context, u *SubtitleUpgrade) (*Response, error) {
+	e := u.Candidate.Entity
+	pv, err := NewProvenance(e, u.Current.Moviehash)
+	if err != nil {
+		return nil, err
+	}
+	if u.Candidate.File != nil && u.Candidate.File.FileID != nil {
+		pv.FileID = *u.Candidate.File.FileID
+		pv.Parameters.FileID = pv.FileID
+	}
+	pv.Parameters.SubFormat = u.Current.Parameters.SubFormat
+
+	o := &DownloadToPathParameters{}
+	if e.Attributes.UploadDate != nil {
+		o.ModTime = *e.Attributes.UploadDate
+	}
+	_, res, err := s.DownloadWithProvenance(ctx, pv, u.Path, o)
+	if err != nil {
+		return res, err
+	}
+	u.Current = pv
+	return res, nil
+}
+
+// Returns the subtitle of the provenance as it was known when it was
+// downloaded.
+func (p *Provenance) entity() *SubtitleEntity {
+	id := p.SubtitleID
+	a := &Subtitle{
+		SubtitleID: &id,
+		Language: &p.Language,
+		ForeignPartsOnly: &p.ForeignPartsOnly,
+		HearingImpaired: &p.HearingImpaired,
+		Uploader: p.Uploader,
+	}
+	if p.Release != "" {
+		a.Release = &p.Release
+	}
+	if p.Ratings > 0 {
+		a.Ratings = &p.Ratings
+	}
+	return &SubtitleEntity{Attributes: a}
+}
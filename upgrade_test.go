@@ -0,0 +1,175 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupUpgrade(t *testing.T, search string, remaining int) (*Client, string, *int, func ()) {
+	client, mux, teardown := setup()
+
+	mux.HandleFunc("/subtitles", func (w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "5", r.URL.Query().Get("id"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, search)
+	})
+
+	n := 0
+	mux.HandleFunc("/download", func (w http.ResponseWriter, r *http.Request) {
+		n += 1
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"link": "%sfile", "remaining": %d, "requests": 1, "reset_time_utc": "2030-01-01T00:00:00Z"}`, client.BaseURL, remaining)
+	})
+	mux.HandleFunc("/file", func (w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "new")
+	})
+
+	return client, t.TempDir(), &n, teardown
+}
+
+func writeUpgradeSubtitle(t *testing.T, path, language string) {
+	err := os.WriteFile(path, []byte("old"), 0644)
+	require.NoError(t, err)
+	err = WriteProvenance(path, &Provenance{
+		SubtitleID: 1,
+		FileID: 1,
+		FeatureID: 5,
+		Language: language,
+		Ratings: 5,
+		SHA256: checksum([]byte("old")),
+	})
+	require.NoError(t, err)
+}
+
+const upgradeSearch = `{"data": [
+	{"attributes": {"subtitle_id": 1, "language": "en", "ratings": 5, "files": [{"file_id": 1}]}},
+	{"attributes": {"subtitle_id": 2, "language": "en", "ratings": 9, "from_trusted": true, "moviehash_match": true, "files": [{"file_id": 2}]}},
+	{"attributes": {"subtitle_id": 3, "language": "en", "ratings": 10, "hearing_impaired": true, "files": [{"file_id": 3}]}},
+	{"attributes": {"subtitle_id": 4, "language": "de", "ratings": 7, "files": [{"file_id": 4}]}}
+]}`
+
+func TestSubtitlesServiceUpgrade_ProposesWithoutApplying(t *testing.T) {
+	client, dir, n, teardown := setupUpgrade(t, upgradeSearch, 10)
+	defer teardown()
+
+	video := filepath.Join(dir, "Movie.2020.mkv")
+	err := os.WriteFile(video, nil, 0644)
+	require.NoError(t, err)
+	sub := filepath.Join(dir, "Movie.2020.en.srt")
+	writeUpgradeSubtitle(t, sub, "en")
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}})
+	require.NoError(t, err)
+	require.Len(t, r.Upgrades, 1)
+	assert.Equal(t, 1, r.Proposed)
+	assert.Equal(t, 0, r.Applied)
+
+	u := r.Upgrades[0]
+	assert.Equal(t, sub, u.Path)
+	assert.Equal(t, video, u.Video)
+	assert.Equal(t, UpgradeProposed, u.Status)
+	assert.Equal(t, ID(2), *u.Candidate.Entity.Attributes.SubtitleID)
+	assert.Greater(t, u.CandidateScore, u.CurrentScore)
+	assert.Contains(t, u.Reasons, "matches the moviehash")
+	assert.Equal(t, 0, *n)
+
+	data, err := os.ReadFile(sub)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+}
+
+func TestSubtitlesServiceUpgrade_AppliesTheReplacement(t *testing.T) {
+	client, dir, n, teardown := setupUpgrade(t, upgradeSearch, 10)
+	defer teardown()
+
+	sub := filepath.Join(dir, "Movie.2020.en.srt")
+	writeUpgradeSubtitle(t, sub, "en")
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}, Apply: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Applied)
+	assert.Equal(t, UpgradeApplied, r.Upgrades[0].Status)
+	assert.Equal(t, 1, *n)
+
+	data, err := os.ReadFile(sub)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	p, err := ReadProvenance(sub)
+	require.NoError(t, err)
+	assert.Equal(t, ID(2), p.SubtitleID)
+	assert.Equal(t, ID(2), p.FileID)
+	assert.Equal(t, checksum([]byte("new")), p.SHA256)
+}
+
+func TestSubtitlesServiceUpgrade_KeepsAnEditedSubtitle(t *testing.T) {
+	client, dir, n, teardown := setupUpgrade(t, upgradeSearch, 10)
+	defer teardown()
+
+	sub := filepath.Join(dir, "Movie.2020.en.srt")
+	writeUpgradeSubtitle(t, sub, "en")
+	err := os.WriteFile(sub, []byte("edited"), 0644)
+	require.NoError(t, err)
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}, Apply: true})
+	require.NoError(t, err)
+	assert.Equal(t, UpgradeEdited, r.Upgrades[0].Status)
+	assert.Equal(t, 0, *n)
+}
+
+func TestSubtitlesServiceUpgrade_DefersOnceTheQuotaReachesTheReserve(t *testing.T) {
+	client, dir, n, teardown := setupUpgrade(t, upgradeSearch, 2)
+	defer teardown()
+
+	writeUpgradeSubtitle(t, filepath.Join(dir, "A.en.srt"), "en")
+	writeUpgradeSubtitle(t, filepath.Join(dir, "B.en.srt"), "en")
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}, Apply: true, Reserve: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Proposed)
+	assert.Equal(t, 1, r.Applied)
+	assert.Equal(t, UpgradeApplied, r.Upgrades[0].Status)
+	assert.Equal(t, UpgradeDeferred, r.Upgrades[1].Status)
+	assert.Equal(t, 1, *n)
+}
+
+func TestSubtitlesServiceUpgrade_StopsAtMaxDownloads(t *testing.T) {
+	client, dir, n, teardown := setupUpgrade(t, upgradeSearch, 10)
+	defer teardown()
+
+	writeUpgradeSubtitle(t, filepath.Join(dir, "A.en.srt"), "en")
+	writeUpgradeSubtitle(t, filepath.Join(dir, "B.en.srt"), "en")
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}, Apply: true, MaxDownloads: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Applied)
+	assert.Equal(t, UpgradeDeferred, r.Upgrades[1].Status)
+	assert.Equal(t, 1, *n)
+}
+
+func TestSubtitlesServiceUpgrade_KeepsTheBestSubtitle(t *testing.T) {
+	client, dir, _, teardown := setupUpgrade(t, upgradeSearch, 10)
+	defer teardown()
+
+	sub := filepath.Join(dir, "A.de.srt")
+	err := os.WriteFile(sub, []byte("old"), 0644)
+	require.NoError(t, err)
+	err = WriteProvenance(sub, &Provenance{SubtitleID: 4, FileID: 4, FeatureID: 5, Language: "de", Ratings: 7})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "B.en.srt"), nil, 0644)
+	require.NoError(t, err)
+
+	r, err := client.Subtitles.Upgrade(context.Background(), &UpgradeParameters{Roots: []string{dir}})
+	require.NoError(t, err)
+	require.Len(t, r.Upgrades, 1)
+	assert.Equal(t, UpgradeCurrent, r.Upgrades[0].Status)
+	assert.Nil(t, r.Upgrades[0].Candidate)
+	assert.Equal(t, 0, r.Proposed)
+}